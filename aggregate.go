@@ -0,0 +1,250 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Количество записей по условию
+// С GroupBy считается количество групп
+func (p *Parent) Count(param *ForeachParam, vals ...interface{}) (n int64, err error) {
+	sqlrq, vals, err := p.aggregateQuery(param, "COUNT(*)", vals)
+	if err != nil {
+		return
+	}
+
+	var v sql.NullInt64
+	err = p.queryRow(sqlrq, vals).Scan(&v)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	n = v.Int64
+	return
+}
+
+// Есть ли хотя бы одна запись по условию
+func (p *Parent) Exists(param *ForeachParam, vals ...interface{}) (ok bool, err error) {
+	fp, err := p.filterParam(param)
+	if err != nil {
+		return
+	}
+
+	where, vals, err := p.buildWhere(fp, vals)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	sqlrq := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE %s)`, p.GetTableName(), where)
+
+	err = p.queryRow(sqlrq, vals).Scan(&ok)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	return
+}
+
+// Агрегатная функция по колонке: SUM, MIN, MAX или AVG
+// MIN и MAX возвращают значение в типе поля, SUM - int64 для целых и float64 для остальных,
+// AVG - float64. Если подходящих записей нет - возвращается nil
+func (p *Parent) Aggregate(param *ForeachParam, fn, col string, vals ...interface{}) (v interface{}, err error) {
+	fn = strings.ToUpper(fn)
+
+	var typ string
+	if i := p.fieldPos(col); i >= 0 && p.Fields[i].IsDb {
+		typ = p.Fields[i].Type
+	}
+	if typ == "" {
+		err = errors.New("unknown field: " + col)
+		log.Println("[error]", err)
+		return
+	}
+
+	switch fn {
+	case "MIN", "MAX":
+	case "SUM":
+		if typ == "int" || typ == "int64" {
+			typ = "int64"
+		} else {
+			typ = "float64"
+		}
+	case "AVG":
+		typ = "float64"
+	default:
+		err = errors.New("bad aggregate function: " + fn)
+		log.Println("[error]", err)
+		return
+	}
+
+	qc, err := quoteColumn(col)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	sqlrq, vals, err := p.aggregateQuery(param, fn+"("+qc+")", vals)
+	if err != nil {
+		return
+	}
+
+	var raw sql.RawBytes
+	rows, err := p.query(sqlrq, vals)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	if !rows.Next() {
+		err = rows.Err()
+		return
+	}
+
+	err = rows.Scan(&raw)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	// NULL - нет подходящих записей
+	if raw == nil {
+		return
+	}
+
+	v, err = parseValue(typ, raw)
+	if err != nil {
+		log.Println("[error]", err, p.DbTable, col, string(raw))
+		return
+	}
+
+	return
+}
+
+// Сумма по колонке
+func (p *Parent) Sum(param *ForeachParam, col string, vals ...interface{}) (interface{}, error) {
+	return p.Aggregate(param, "SUM", col, vals...)
+}
+
+// Минимальное значение колонки
+func (p *Parent) Min(param *ForeachParam, col string, vals ...interface{}) (interface{}, error) {
+	return p.Aggregate(param, "MIN", col, vals...)
+}
+
+// Максимальное значение колонки
+func (p *Parent) Max(param *ForeachParam, col string, vals ...interface{}) (interface{}, error) {
+	return p.Aggregate(param, "MAX", col, vals...)
+}
+
+// Среднее значение колонки
+func (p *Parent) Avg(param *ForeachParam, col string, vals ...interface{}) (interface{}, error) {
+	return p.Aggregate(param, "AVG", col, vals...)
+}
+
+// Агрегатная функция с результатом нужного типа
+// ok - false, если подходящих записей нет
+func AggregateAs[T any](p *Parent, param *ForeachParam, fn, col string, vals ...interface{}) (v T, ok bool, err error) {
+	i, err := p.Aggregate(param, fn, col, vals...)
+	if err != nil || i == nil {
+		return
+	}
+
+	v, ok = i.(T)
+	if !ok {
+		err = fmt.Errorf("aggregate %s(%s.%s) has type %T", fn, p.DbTable, col, i)
+	}
+
+	return
+}
+
+// Сумма по колонке нужного типа
+func SumAs[T any](p *Parent, param *ForeachParam, col string, vals ...interface{}) (T, bool, error) {
+	return AggregateAs[T](p, param, "SUM", col, vals...)
+}
+
+// Минимальное значение колонки нужного типа
+func MinAs[T any](p *Parent, param *ForeachParam, col string, vals ...interface{}) (T, bool, error) {
+	return AggregateAs[T](p, param, "MIN", col, vals...)
+}
+
+// Максимальное значение колонки нужного типа
+func MaxAs[T any](p *Parent, param *ForeachParam, col string, vals ...interface{}) (T, bool, error) {
+	return AggregateAs[T](p, param, "MAX", col, vals...)
+}
+
+// Среднее значение колонки нужного типа
+func AvgAs[T any](p *Parent, param *ForeachParam, col string, vals ...interface{}) (T, bool, error) {
+	return AggregateAs[T](p, param, "AVG", col, vals...)
+}
+
+// Копия параметров с проверкой, сортировка и лимиты для агрегатов не нужны
+func (p *Parent) filterParam(param *ForeachParam) (fp *ForeachParam, err error) {
+	fp = &ForeachParam{}
+	if param != nil {
+		*fp = *param
+		fp.CondEntries = append([]string(nil), param.CondEntries...)
+	}
+
+	err = p.cleanParam(fp)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	return
+}
+
+// Запрос агрегатной функции по условию
+func (p *Parent) aggregateQuery(param *ForeachParam, expr string, vals []interface{}) (sqlrq string, args []interface{}, err error) {
+	fp, err := p.filterParam(param)
+	if err != nil {
+		return
+	}
+
+	where, args, err := p.buildWhere(fp, vals)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	if fp.GroupBy != "" {
+		if expr != "COUNT(*)" {
+			err = errors.New("GROUP BY is supported only for Count")
+			log.Println("[error]", err)
+			return
+		}
+
+		sqlrq = fmt.Sprintf(`SELECT %s FROM (SELECT 1 FROM %s WHERE %s GROUP BY %s) t`,
+			expr, p.GetTableName(), where, fp.GroupBy)
+		return
+	}
+
+	sqlrq = fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, expr, p.GetTableName(), where)
+	return
+}
+
+// Выполняем запрос в транзакции объекта или без нее
+func (p *Parent) query(sqlrq string, vals []interface{}) (*sql.Rows, error) {
+	if p.Tx != nil {
+		return p.Tx.Query(sqlrq, vals...)
+	}
+
+	return Dbh.Query(sqlrq, vals...)
+}
+
+// Выполняем запрос одной строки в транзакции объекта или без нее
+func (p *Parent) queryRow(sqlrq string, vals []interface{}) *sql.Row {
+	if p.Tx != nil {
+		return p.Tx.QueryRow(sqlrq, vals...)
+	}
+
+	return Dbh.QueryRow(sqlrq, vals...)
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Действия, которые попадают в журнал изменений
+const (
+	AuditInsert  = "insert"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// Запись журнала изменений
+type AuditEntry struct {
+	Table   string      `json:"table"`
+	PK      interface{} `json:"pk"`
+	Action  string      `json:"action"`
+	Changes []Change    `json:"changes"`
+	// Условие и значения для удаления группы записей
+	Where string        `json:"where,omitempty"`
+	Args  []interface{} `json:"args,omitempty"`
+	Actor string        `json:"actor"`
+	Time  time.Time     `json:"time"`
+}
+
+// Куда пишется журнал изменений
+// tx - транзакция, в которой выполняется изменение
+type AuditSink interface {
+	WriteAudit(tx *sqlx.Tx, e *AuditEntry) error
+}
+
+// Журнал в таблице базы
+// Таблица должна содержать колонки tbl, pk, action, changes, actor, created
+type AuditTable struct {
+	Table string
+}
+
+func (at AuditTable) WriteAudit(tx *sqlx.Tx, e *AuditEntry) (err error) {
+	if !columnNameReg.MatchString(at.Table) {
+		err = errors.New("bad audit table name: " + at.Table)
+		return
+	}
+
+	changes, err := json.Marshal(struct {
+		Changes []Change      `json:"changes"`
+		Where   string        `json:"where,omitempty"`
+		Args    []interface{} `json:"args,omitempty"`
+	}{e.Changes, e.Where, e.Args})
+	if err != nil {
+		return
+	}
+
+	var pk interface{}
+	if e.PK != nil {
+		pk = fmt.Sprint(e.PK)
+		if b, ok := e.PK.([]byte); ok {
+			pk = FormatUUID(b)
+		}
+	}
+
+	sqlrq := fmt.Sprintf("INSERT INTO `%s` SET `tbl`=?, `pk`=?, `action`=?, `changes`=?, `actor`=?, `created`=?",
+		at.Table)
+	vals := []interface{}{e.Table, pk, e.Action, string(changes), e.Actor,
+		e.Time.Format(GetMysqlTimeFormat())}
+
+	if tx != nil {
+		_, err = tx.Exec(sqlrq, vals...)
+	} else {
+		_, err = Dbh.Exec(sqlrq, vals...)
+	}
+
+	return
+}
+
+// Ключ автора изменений в контексте
+type actorCtxKey struct{}
+
+// Контекст с автором изменений для журнала
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorCtxKey{}, actor)
+}
+
+// Автор изменений из контекста
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	actor, _ := ctx.Value(actorCtxKey{}).(string)
+	return actor
+}
+
+// Привязываем контекст к объекту, из него берется автор изменений
+func (p *Parent) WithContext(ctx context.Context) *Parent {
+	p.ctx = ctx
+	return p
+}
+
+// Новая запись журнала или nil, если журнал для таблицы не включен
+func (p *Parent) newAudit(action string, changes []Change) *AuditEntry {
+	if p.Audit == nil {
+		return nil
+	}
+
+	return &AuditEntry{
+		Table:   p.DbTable,
+		PK:      p.Get(p.PKey),
+		Action:  action,
+		Changes: changes,
+		Actor:   ActorFromContext(p.ctx),
+		Time:    Now(),
+	}
+}
+
+// Все значения записи как изменения при удалении
+func (p *Parent) deleteChanges() (changes []Change) {
+	p.RLock()
+	for _, f := range p.Fields {
+		if f.IsDb {
+			changes = append(changes, Change{Name: f.Name, Old: f.Value})
+		}
+	}
+	p.RUnlock()
+
+	return
+}
+
+// Если журнал включен, а транзакции нет - начинаем свою, чтобы запись журнала была атомарной
+func (p *Parent) auditBegin(e *AuditEntry) (owned bool, err error) {
+	if e == nil || p.Tx != nil {
+		return
+	}
+
+	p.Tx, err = beginTxx(nil)
+	if err != nil {
+		return
+	}
+
+	owned = true
+	return
+}
+
+// Откатываем свою транзакцию при ошибке
+func (p *Parent) auditRollback(owned bool, err error) {
+	if !owned || err == nil || p.Tx == nil {
+		return
+	}
+
+	if rerr := p.Rollback(); rerr != nil {
+		log.Println("[error]", rerr)
+	}
+}
+
+// Пишем запись журнала в транзакции объекта
+func (p *Parent) writeAudit(e *AuditEntry) (err error) {
+	if e == nil {
+		return
+	}
+
+	err = p.Audit.WriteAudit(p.Tx, e)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,103 @@
+package db
+
+// Изменение поля, которое будет записано при коммите
+type Change struct {
+	Name string      `json:"name"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+	// Особое значение, например [[+=1]], если оно задано через SetSpecial
+	Special string `json:"special,omitempty"`
+}
+
+// Список несохраненных изменений
+func (p *Parent) Changes() (changes []Change) {
+	p.RLock()
+	for _, f := range p.Fields {
+		if f._to_commit && f.IsDb {
+			changes = append(changes, Change{
+				Name:    f.Name,
+				Old:     f._original,
+				New:     f.Value,
+				Special: f._special_value,
+			})
+		}
+	}
+	p.RUnlock()
+
+	return
+}
+
+// Есть ли несохраненные изменения поля
+func (p *Parent) IsDirty(n string) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	i := p.fieldPos(n)
+	return i >= 0 && p.Fields[i]._to_commit && p.Fields[i].IsDb
+}
+
+// Есть ли несохраненные изменения
+func (p *Parent) HasChanges() bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	for _, f := range p.Fields {
+		if f._to_commit && f.IsDb {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Отменяем изменение поля
+func (p *Parent) Reset(n string) {
+	p.Lock()
+	if i := p.fieldPos(n); i >= 0 {
+		p.Fields[i].discard()
+	}
+	p.Unlock()
+}
+
+// Отменяем все несохраненные изменения
+func (p *Parent) Discard() {
+	p.Lock()
+	for i := range p.Fields {
+		p.Fields[i].discard()
+	}
+	p.Unlock()
+}
+
+// Возвращаем значение до изменения
+func (f *Field) discard() {
+	if !f._to_commit {
+		return
+	}
+
+	f.Value = f._original
+	f.clearDirty()
+}
+
+// Запоминаем значение до первого изменения
+func (f *Field) markDirty() {
+	if !f._to_commit {
+		f._original = f.Value
+	}
+	f._to_commit = true
+}
+
+// Снимаем отметку об изменении
+func (f *Field) clearDirty() {
+	f._to_commit = false
+	f._special_value = ""
+	f._original = nil
+}
+
+// Снимаем отметки после записи в базу
+func (p *Parent) clearDirty() {
+	p.Lock()
+	for i := range p.Fields {
+		p.Fields[i].clearDirty()
+	}
+	p.Unlock()
+}
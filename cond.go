@@ -0,0 +1,200 @@
+package db
+
+import (
+	"errors"
+	"strings"
+)
+
+// Условие выборки с параметрами для подстановки
+// Собирается функциями Eq, In, And, Or и т.д., значения всегда передаются через ?
+type Cond struct {
+	sql  string
+	args []interface{}
+	err  error
+}
+
+// SQL условия и значения параметров
+func (c Cond) SQL() (string, []interface{}, error) {
+	if c.err != nil {
+		return "", nil, c.err
+	}
+	if c.sql == "" {
+		return "1", nil, nil
+	}
+
+	return c.sql, c.args, nil
+}
+
+// Пустое ли условие
+func (c Cond) IsEmpty() bool {
+	return c.sql == "" && c.err == nil
+}
+
+// Экранируем название колонки
+func quoteColumn(col string) (string, error) {
+	if !columnNameReg.MatchString(col) {
+		return "", errors.New("bad column name: " + col)
+	}
+
+	return "`" + strings.Replace(col, ".", "`.`", 1) + "`", nil
+}
+
+// Условие сравнения колонки со значением
+func compare(col, op string, v interface{}) Cond {
+	qc, err := quoteColumn(col)
+	if err != nil {
+		return Cond{err: err}
+	}
+
+	return Cond{sql: qc + op + "?", args: []interface{}{v}}
+}
+
+// col = v
+func Eq(col string, v interface{}) Cond {
+	return compare(col, "=", v)
+}
+
+// col != v
+func Ne(col string, v interface{}) Cond {
+	return compare(col, "!=", v)
+}
+
+// col > v
+func Gt(col string, v interface{}) Cond {
+	return compare(col, ">", v)
+}
+
+// col >= v
+func Gte(col string, v interface{}) Cond {
+	return compare(col, ">=", v)
+}
+
+// col < v
+func Lt(col string, v interface{}) Cond {
+	return compare(col, "<", v)
+}
+
+// col <= v
+func Lte(col string, v interface{}) Cond {
+	return compare(col, "<=", v)
+}
+
+// col LIKE pattern
+func Like(col, pattern string) Cond {
+	return compare(col, " LIKE ", pattern)
+}
+
+// col NOT LIKE pattern
+func NotLike(col, pattern string) Cond {
+	return compare(col, " NOT LIKE ", pattern)
+}
+
+// col BETWEEN from AND to
+func Between(col string, from, to interface{}) Cond {
+	qc, err := quoteColumn(col)
+	if err != nil {
+		return Cond{err: err}
+	}
+
+	return Cond{sql: qc + " BETWEEN ? AND ?", args: []interface{}{from, to}}
+}
+
+// col IS NULL
+func IsNull(col string) Cond {
+	qc, err := quoteColumn(col)
+	if err != nil {
+		return Cond{err: err}
+	}
+
+	return Cond{sql: qc + " IS NULL"}
+}
+
+// col IS NOT NULL
+func IsNotNull(col string) Cond {
+	qc, err := quoteColumn(col)
+	if err != nil {
+		return Cond{err: err}
+	}
+
+	return Cond{sql: qc + " IS NOT NULL"}
+}
+
+// col IN (vals), для пустого списка условие всегда ложно
+func In[T any](col string, vals []T) Cond {
+	return inList(col, " IN ", "0", vals)
+}
+
+// col NOT IN (vals), для пустого списка условие всегда истинно
+func NotIn[T any](col string, vals []T) Cond {
+	return inList(col, " NOT IN ", "1", vals)
+}
+
+func inList[T any](col, op, empty string, vals []T) Cond {
+	qc, err := quoteColumn(col)
+	if err != nil {
+		return Cond{err: err}
+	}
+
+	if len(vals) == 0 {
+		return Cond{sql: empty}
+	}
+
+	args := make([]interface{}, len(vals))
+	for i, v := range vals {
+		args[i] = v
+	}
+
+	return Cond{
+		sql:  qc + op + "(" + strings.TrimSuffix(strings.Repeat("?,", len(vals)), ",") + ")",
+		args: args,
+	}
+}
+
+// Все условия должны выполняться
+func And(conds ...Cond) Cond {
+	return join(" AND ", "1", conds)
+}
+
+// Хотя бы одно условие должно выполняться
+func Or(conds ...Cond) Cond {
+	return join(" OR ", "0", conds)
+}
+
+// Отрицание условия
+func Not(c Cond) Cond {
+	if c.err != nil {
+		return c
+	}
+	if c.sql == "" {
+		return Cond{sql: "0"}
+	}
+
+	return Cond{sql: "NOT (" + c.sql + ")", args: c.args}
+}
+
+// Произвольное условие, значения передаются через ?
+func Raw(sqlstr string, args ...interface{}) Cond {
+	return Cond{sql: sqlstr, args: args}
+}
+
+func join(sep, empty string, conds []Cond) Cond {
+	parts := []string{}
+	args := []interface{}{}
+
+	for _, c := range conds {
+		if c.err != nil {
+			return c
+		}
+		if c.sql == "" {
+			continue
+		}
+
+		parts = append(parts, "("+c.sql+")")
+		args = append(args, c.args...)
+	}
+
+	if len(parts) == 0 {
+		return Cond{sql: empty}
+	}
+	return Cond{sql: strings.Join(parts, sep), args: args}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCondSQL(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cond Cond
+		sql  string
+		args []interface{}
+	}{
+		{"empty", Cond{}, "1", nil},
+		{"eq", Eq("id", 5), "`id`=?", []interface{}{5}},
+		{"eq table", Eq("t.id", 5), "`t`.`id`=?", []interface{}{5}},
+		{"ne", Ne("a", "x"), "`a`!=?", []interface{}{"x"}},
+		{"like", Like("name", "a%"), "`name` LIKE ?", []interface{}{"a%"}},
+		{"between", Between("n", 1, 9), "`n` BETWEEN ? AND ?", []interface{}{1, 9}},
+		{"is null", IsNull("deleted_at"), "`deleted_at` IS NULL", nil},
+		{"in", In("id", []int{1, 2, 3}), "`id` IN (?,?,?)", []interface{}{1, 2, 3}},
+		{"in empty", In("id", []int{}), "0", nil},
+		{"not in", NotIn("id", []string{"a"}), "`id` NOT IN (?)", []interface{}{"a"}},
+		{"not in empty", NotIn("id", []string(nil)), "1", nil},
+		{"and", And(Eq("a", 1), Gt("b", 2)), "(`a`=?) AND (`b`>?)", []interface{}{1, 2}},
+		{"and skips empty", And(Cond{}, Eq("a", 1)), "(`a`=?)", []interface{}{1}},
+		{"and empty", And(), "1", nil},
+		{"or", Or(Eq("a", 1), Lt("b", 2)), "(`a`=?) OR (`b`<?)", []interface{}{1, 2}},
+		{"or empty", Or(), "0", nil},
+		{"not", Not(Eq("a", 1)), "NOT (`a`=?)", []interface{}{1}},
+		{"not empty", Not(Cond{}), "0", nil},
+		{
+			"nested",
+			And(Eq("a", 1), Or(In("b", []int{2, 3}), Not(IsNull("c")))),
+			"(`a`=?) AND ((`b` IN (?,?)) OR (NOT (`c` IS NULL)))",
+			[]interface{}{1, 2, 3},
+		},
+		{"raw", Raw("`a`+`b`>?", 10), "`a`+`b`>?", []interface{}{10}},
+	} {
+		sql, args, err := tc.cond.SQL()
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if sql != tc.sql {
+			t.Errorf("%s: sql %q, want %q", tc.name, sql, tc.sql)
+		}
+		if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s: args %#v, want %#v", tc.name, args, tc.args)
+		}
+	}
+}
+
+func TestCondBadColumn(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cond Cond
+	}{
+		{"eq", Eq("id; DROP TABLE t", 1)},
+		{"backtick", Eq("a`b", 1)},
+		{"space", Gt("a b", 1)},
+		{"empty", Lt("", 1)},
+		{"two dots", Eq("a.b.c", 1)},
+		{"in", In("1id", []int{1})},
+		{"empty in", In("a-b", []int{})},
+		{"is null", IsNull("a)")},
+		{"between", Between("a,b", 1, 2)},
+		{"inside and", And(Eq("a", 1), Eq("b--", 2))},
+		{"inside or", Or(Eq("a", 1), Eq("b'", 2))},
+		{"inside not", Not(Eq("(a)", 1))},
+	} {
+		if !tc.cond.IsEmpty() {
+			if _, _, err := tc.cond.SQL(); err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		t.Errorf("%s: bad condition is empty", tc.name)
+	}
+}
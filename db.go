@@ -30,19 +30,18 @@ func (p *Parent) GetFiledsString() string {
 }
 
 // Добавляем поле в объект
+// Индекс сбрасывается и строится заново при следующем поиске поля
 func (p *Parent) AddField(f Field) {
 	p.Fields = append(p.Fields, f)
+	p.fieldIdx.Store(nil)
 }
 
 // Устанавливаем особое значение
 func (p *Parent) SetSpecial(n, v string) {
 	p.Lock()
-	for i := range p.Fields {
-		if p.Fields[i].Name == n {
-			p.Fields[i]._to_commit = true
-			p.Fields[i]._special_value = v
-			break
-		}
+	if i := p.fieldPos(n); i >= 0 {
+		p.Fields[i].markDirty()
+		p.Fields[i]._special_value = v
 	}
 	p.Unlock()
 }
@@ -50,57 +49,101 @@ func (p *Parent) SetSpecial(n, v string) {
 // Устанавливаем значение объекта
 func (p *Parent) Set(n string, v interface{}) {
 	p.Lock()
-	for i := range p.Fields {
-		if p.Fields[i].Name == n {
-			// Првоеряем тип переменной
-			if p.Fields[i].Type != reflect.TypeOf(v).String() {
-				log.Fatalln("[fatal]", "bad type field", p.Fields[i].Type, reflect.TypeOf(v), v)
-			}
+	i := p.fieldPos(n)
+	if i >= 0 {
+		// Првоеряем тип переменной
+		if p.Fields[i].Type != reflect.TypeOf(v).String() {
+			log.Fatalln("[fatal]", "bad type field", p.Fields[i].Type, reflect.TypeOf(v), v)
+		}
 
-			// Для времени своя сверка
-			if p.Fields[i].Type == "time.Time" {
-				// Если старое значение не указано
-				if p.Fields[i].Value == nil {
-					p.Fields[i]._to_commit = true
-				} else {
-					t1 := p.Fields[i].Value.(time.Time)
-					t2 := v.(time.Time)
-					if t1.String() != t2.String() {
-						p.Fields[i]._to_commit = true
-					}
-				}
+		// Для времени своя сверка
+		if p.Fields[i].Type == "time.Time" {
+			// Если старое значение не указано
+			if p.Fields[i].Value == nil {
+				p.Fields[i].markDirty()
 			} else {
-				// Отмечаем надо ли обновить переменную при коммите
-				if p.Fields[i].IsDb && p.Fields[i].Value != v {
-					p.Fields[i]._to_commit = true
+				t1 := p.Fields[i].Value.(time.Time)
+				t2 := v.(time.Time)
+				if t1.String() != t2.String() {
+					p.Fields[i].markDirty()
 				}
 			}
-
-			// Только если изменилось значение
-			if p.Fields[i]._to_commit {
-				// Проверяем не NULL ли это
-				p.Fields[i].CheckNullValue(v)
+		} else {
+			// Отмечаем надо ли обновить переменную при коммите
+			if p.Fields[i].IsDb && p.Fields[i].Value != v {
+				p.Fields[i].markDirty()
 			}
+		}
 
-			// Обновляем
-			p.Fields[i].Value = v
-
-			break
+		// Только если изменилось значение
+		if p.Fields[i]._to_commit {
+			// Проверяем не NULL ли это
+			p.Fields[i].CheckNullValue(v)
 		}
+
+		// Обновляем
+		p.Fields[i].Value = v
+
+		// Значение известно, даже если не загружалось из базы
+		p.Fields[i]._loaded = true
 	}
 	p.Unlock()
 }
 
 // Получаем значение объекта
+// При включенном LazyLoad незагруженные поля подгружаются из базы
 func (p *Parent) Get(n string) (v interface{}) {
+	v, _ = p.get(n)
+	return
+}
+
+// Получаем значение объекта с ошибкой для полей, которые не были загружены из базы
+func (p *Parent) GetErr(n string) (v interface{}, err error) {
+	v, loaded := p.get(n)
+	if !loaded {
+		err = fmt.Errorf("%w: %s.%s", ErrNotLoaded, p.DbTable, n)
+	}
+
+	return
+}
+
+// Получаем значение объекта нужного типа с ошибкой для незагруженных полей
+func GetAs[T any](p *Parent, n string) (v T, err error) {
+	i, err := p.GetErr(n)
+	if err != nil || i == nil {
+		return
+	}
+
+	v, ok := i.(T)
+	if !ok {
+		err = fmt.Errorf("field %s.%s has type %T", p.DbTable, n, i)
+	}
+
+	return
+}
+
+// Значение поля и известно ли оно
+func (p *Parent) get(n string) (v interface{}, loaded bool) {
 	p.RLock()
-	for _, f := range p.Fields {
-		if f.Name == n {
-			v = f.Value
-			break
-		}
+	i := p.fieldPos(n)
+	if i >= 0 {
+		v = p.Fields[i].Value
+		loaded = !p.Existed || p.Fields[i]._loaded
 	}
 	p.RUnlock()
+
+	// Подгружаем недостающие поля
+	if i >= 0 && !loaded && p.LazyLoad {
+		if p.loadMissing() != nil {
+			return
+		}
+
+		p.RLock()
+		v = p.Fields[i].Value
+		loaded = p.Fields[i]._loaded
+		p.RUnlock()
+	}
+
 	return
 }
 
@@ -201,16 +244,12 @@ func (p *Parent) GetTime(n string) (v time.Time) {
 
 // Возвращаем json объета
 func (p *Parent) GetJson() (b []byte) {
-	js := make(map[string]interface{}, len(p.Fields))
-	p.RLock()
-	for _, f := range p.Fields {
-		if f.IsJson {
-			js[f.Name] = f.Value
-		}
-	}
-	p.RUnlock()
+	return p.GetJsonVersion("")
+}
 
-	b, err := json.Marshal(js)
+// Возвращаем json объекта для версии API
+func (p *Parent) GetJsonVersion(version string) (b []byte) {
+	b, err := json.Marshal(p.GetMapVersion(version))
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -220,15 +259,73 @@ func (p *Parent) GetJson() (b []byte) {
 
 // Возвращаем хэш объекта
 func (p *Parent) GetMap() (m map[string]interface{}) {
+	return p.GetMapVersion("")
+}
+
+// Возвращаем хэш объекта для версии API
+// После полей вызываются MapAddFunc для вычисляемых значений и MapVersionFunc
+// для удаления и переименования ключей под версию
+func (p *Parent) GetMapVersion(version string) (m map[string]interface{}) {
 	m = make(map[string]interface{}, len(p.Fields))
+
+	// Подгружаем недостающие поля, иначе отдадим нулевые значения вместо данных из базы
+	if p.LazyLoad && p.Existed {
+		p.loadMissing()
+	}
+
 	p.RLock()
-	for _, f := range p.Fields {
-		if f.IsJson {
+	for i := range p.Fields {
+		f := &p.Fields[i]
+		if !f.IsJson {
+			continue
+		}
+
+		// Незагруженные поля не отдаем
+		if f.IsDb && p.Existed && !f._loaded {
+			continue
+		}
+
+		// Бинарные UUID и ULID отдаем строкой
+		if s, ok := p.formatKey(f); ok {
+			m[f.Name] = s
+		} else {
 			m[f.Name] = f.Value
 		}
 	}
+	related := make(map[string]interface{}, len(p.related))
+	for k, v := range p.related {
+		related[k] = v
+	}
 	p.RUnlock()
 
+	// Загруженные связи
+	for name, v := range related {
+		switch r := v.(type) {
+		case *Parent:
+			if r == nil {
+				m[name] = nil
+			} else {
+				m[name] = r.GetMapVersion(version)
+			}
+		case []*Parent:
+			arr := make([]map[string]interface{}, len(r))
+			for i, o := range r {
+				arr[i] = o.GetMapVersion(version)
+			}
+			m[name] = arr
+		}
+	}
+
+	// Дополнительные значения
+	if p.MapAddFunc != nil {
+		p.MapAddFunc(m)
+	}
+
+	// Правка ключей под версию API
+	if p.MapVersionFunc != nil {
+		p.MapVersionFunc(m, version)
+	}
+
 	return
 }
 
@@ -261,6 +358,7 @@ func (p *Parent) ByteToDescribe(b []byte) {
 		log.Println("[error]", err)
 		return
 	}
+	p.reindexFields()
 
 	return
 }
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Удаление записи
+// Если для таблицы включено мягкое удаление - только отмечаем время удаления
+func (p *Parent) Delete() (err error) {
+	return p.DeleteTx(true)
+}
+
+// Удаление записи с возможностью не коммитить транзакцию
+func (p *Parent) DeleteTx(txcommit bool) (err error) {
+	if p.SoftDelete == "" {
+		return p.HardDeleteTx(txcommit)
+	}
+
+	err = p.runHooks(BeforeDelete)
+	if err != nil {
+		return
+	}
+
+	// Уже удаленную запись не трогаем, чтобы сохранить исходное время удаления
+	t := Now()
+	sqlrq := fmt.Sprintf("UPDATE %s SET `%s`=? WHERE %s=? AND %s", p.GetTableName(),
+		p.SoftDelete, p.PKey, p.softDeleteCond())
+
+	e := p.newAudit(AuditDelete, []Change{{Name: p.SoftDelete, Old: p.Get(p.SoftDelete), New: t}})
+	n, err := p.deleteExec(txcommit, e, sqlrq, t.Format(GetMysqlTimeFormat()), p.Get(p.PKey))
+	if err != nil {
+		return
+	}
+
+	// Запись уже была удалена - удалять было нечего
+	if n == 0 {
+		return
+	}
+
+	p.setDeletedValue(t)
+	return p.runHooks(AfterDelete)
+}
+
+// Физическое удаление записи независимо от настроек таблицы
+func (p *Parent) HardDelete() (err error) {
+	return p.HardDeleteTx(true)
+}
+
+// Физическое удаление записи с возможностью не коммитить транзакцию
+func (p *Parent) HardDeleteTx(txcommit bool) (err error) {
+	err = p.runHooks(BeforeDelete)
+	if err != nil {
+		return
+	}
+
+	sqlrq := fmt.Sprintf(`DELETE FROM %s WHERE %s=?`, p.GetTableName(), p.PKey)
+
+	var e *AuditEntry
+	if p.Audit != nil {
+		e = p.newAudit(AuditDelete, p.deleteChanges())
+	}
+	_, err = p.deleteExec(txcommit, e, sqlrq, p.Get(p.PKey))
+	if err != nil {
+		return
+	}
+
+	return p.runHooks(AfterDelete)
+}
+
+// Восстановление мягко удаленной записи
+func (p *Parent) Restore() (err error) {
+	return p.RestoreTx(true)
+}
+
+// Восстановление мягко удаленной записи с возможностью не коммитить транзакцию
+func (p *Parent) RestoreTx(txcommit bool) (err error) {
+	if p.SoftDelete == "" {
+		err = errors.New("soft delete is not enabled for " + p.DbTable)
+		log.Println("[error]", err)
+		return
+	}
+
+	sqlrq := fmt.Sprintf("UPDATE %s SET `%s`=NULL WHERE %s=?", p.GetTableName(),
+		p.SoftDelete, p.PKey)
+
+	e := p.newAudit(AuditRestore, []Change{{Name: p.SoftDelete, Old: p.Get(p.SoftDelete)}})
+	_, err = p.deleteExec(txcommit, e, sqlrq, p.Get(p.PKey))
+	if err != nil {
+		return
+	}
+
+	p.setDeletedValue(nil)
+	return
+}
+
+// Удаление записи по вторичному ключу
+func (p *Parent) DeleteBySK(skn string, skv interface{}, txcommit bool) (n int64, err error) {
+	var key string
+	for _, k := range p.SKeys {
+		if k == skn {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		err = errors.New("unknown secondary key: " + skn)
+		log.Println("[error]", err)
+		return
+	}
+
+	return p.DeleteWhere(&ForeachParam{Filter: Eq(key, skv)}, txcommit)
+}
+
+// Удаление группы записей по условию
+// Используются Where, CondEntries, Filter, OrderBy и Limit из параметров
+// Без условия возвращается ошибка, чтобы случайно не удалить всю таблицу
+func (p *Parent) DeleteWhere(param *ForeachParam, txcommit bool, vals ...interface{}) (n int64, err error) {
+	// Работаем с проверенной копией, переданные параметры не изменяются
+	param, err = p.filterParam(param)
+	if err != nil {
+		return
+	}
+
+	if !param.hasCond() {
+		err = errors.New("delete without condition: " + p.DbTable)
+		log.Println("[error]", err)
+		return
+	}
+
+	where, vals, err := p.buildWhere(param, vals)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	// Дополнительные части запроса
+	tail := ""
+	if len(param.OrderBy) > 0 {
+		var ob string
+		ob, err = orderClause(param.OrderBy)
+		if err != nil {
+			log.Println("[error]", err)
+			return
+		}
+		tail += " ORDER BY " + ob
+	}
+	if param.Limit > 0 {
+		tail += fmt.Sprintf(" LIMIT %d", param.Limit)
+	}
+
+	// Значения условия для журнала, без значения SET
+	whereArgs := vals
+
+	var sqlrq string
+	if p.SoftDelete != "" {
+		sqlrq = fmt.Sprintf("UPDATE %s SET `%s`=? WHERE %s%s", p.GetTableName(),
+			p.SoftDelete, where, tail)
+		vals = append([]interface{}{Now().Format(GetMysqlTimeFormat())}, vals...)
+	} else {
+		sqlrq = fmt.Sprintf(`DELETE FROM %s WHERE %s%s`, p.GetTableName(), where, tail)
+	}
+
+	// Для группы записей в журнал попадает условие удаления
+	var e *AuditEntry
+	if p.Audit != nil {
+		e = p.newAudit(AuditDelete, nil)
+		e.PK = nil
+		e.Where = where
+		e.Args = whereArgs
+	}
+
+	return p.deleteExec(txcommit, e, sqlrq, vals...)
+}
+
+// Проверяем удалена ли запись мягким удалением
+func (p *Parent) IsDeleted() bool {
+	if p.SoftDelete == "" {
+		return false
+	}
+
+	t, ok := p.Get(p.SoftDelete).(time.Time)
+	return ok && !t.IsZero()
+}
+
+// Выполняем запрос удаления/восстановления
+// Если передана запись журнала - она пишется в той же транзакции, но только если запрос изменил записи
+func (p *Parent) deleteExec(txcommit bool, e *AuditEntry, sqlrq string, vals ...interface{}) (n int64, err error) {
+	// Общую транзакцию коммитит WithTx
+	if p.txManaged {
+		txcommit = false
+	}
+
+	owned, err := p.auditBegin(e)
+	if err != nil {
+		return
+	}
+	if owned {
+		txcommit = true
+		defer func() { p.auditRollback(owned, err) }()
+	}
+
+	var r sql.Result
+	if p.Tx != nil {
+		r, err = p.Tx.Exec(sqlrq, vals...)
+	} else {
+		r, err = Dbh.Exec(sqlrq, vals...)
+	}
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	n, err = r.RowsAffected()
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	if n > 0 {
+		err = p.writeAudit(e)
+		if err != nil {
+			return
+		}
+	}
+
+	// Если надо сделать коммит
+	if p.Tx != nil && txcommit {
+		err = p.commitTx()
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Обновляем значение поля удаления без отметки к коммиту
+func (p *Parent) setDeletedValue(v interface{}) {
+	p.Lock()
+	if i := p.fieldPos(p.SoftDelete); i >= 0 {
+		p.Fields[i].Value = v
+		p.Fields[i].clearDirty()
+	}
+	p.Unlock()
+}
+
+// Условие для исключения мягко удаленных записей
+func (p *Parent) softDeleteCond() string {
+	return "`" + p.SoftDelete + "` IS NULL"
+}
+
+// Задано ли в параметрах условие выборки
+func (fp *ForeachParam) hasCond() bool {
+	if strings.TrimSpace(fp.Where) != "" || !fp.Filter.IsEmpty() {
+		return true
+	}
+
+	for _, c := range fp.CondEntries {
+		if strings.TrimSpace(c) != "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Ошибка при обращении к полю, которое не было загружено из базы
+var ErrNotLoaded = errors.New("field is not loaded")
+
+// Индекс полей по названию
+// Карта не изменяется после создания, поэтому ее можно делить между объектами одной таблицы
+type fieldIndex map[string]int
+
+// Строим индекс по текущим полям
+func (p *Parent) buildFieldIndex() *fieldIndex {
+	idx := make(fieldIndex, len(p.Fields))
+	for i, f := range p.Fields {
+		if _, ok := idx[f.Name]; !ok {
+			idx[f.Name] = i
+		}
+	}
+
+	return &idx
+}
+
+// Перестраиваем индекс полей
+// Вызывается после изменения состава полей
+func (p *Parent) reindexFields() {
+	p.fieldIdx.Store(p.buildFieldIndex())
+}
+
+// Позиция поля по названию или -1
+// Индекс строится при первом обращении, так что объекты с заполненными вручную Fields тоже его получают.
+// Если Fields изменили напрямую и индекс устарел - ищем перебором
+func (p *Parent) fieldPos(n string) int {
+	idx := p.fieldIdx.Load()
+	if idx == nil {
+		// Вызывается и под RLock, поэтому индекс ставим атомарно
+		idx = p.buildFieldIndex()
+		if !p.fieldIdx.CompareAndSwap(nil, idx) {
+			idx = p.fieldIdx.Load()
+		}
+	}
+	if i, ok := (*idx)[n]; ok && i < len(p.Fields) && p.Fields[i].Name == n {
+		return i
+	}
+	for i := range p.Fields {
+		if p.Fields[i].Name == n {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Позиции полей для колонок результата, -1 для колонок без поля
+func (p *Parent) columnPos(columns []string) []int {
+	pos := make([]int, len(columns))
+	for i, c := range columns {
+		pos[i] = p.fieldPos(c)
+		if pos[i] >= 0 && !p.Fields[pos[i]].IsDb {
+			pos[i] = -1
+		}
+	}
+
+	return pos
+}
+
+// Читаем одну строку результата по заранее найденным позициям полей
+func (p *Parent) parseDbRow(rows *sql.Rows, pos []int) (err error) {
+	// Отмечаем что это существующая запись
+	p.Existed = true
+
+	if !rows.Next() {
+		err = rows.Err()
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return
+	}
+
+	// Make a slice for the values
+	values := make([]sql.RawBytes, len(pos))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	err = rows.Scan(scanArgs...)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	for i, col := range values {
+		k := pos[i]
+		if k < 0 {
+			continue
+		}
+
+		// Поле выбрано из базы, даже если там NULL
+		p.Fields[k]._loaded = true
+
+		if col == nil {
+			continue
+		}
+
+		var v interface{}
+		v, err = parseValue(p.Fields[k].Type, col)
+		if err != nil {
+			log.Println("[error]", err, p.DbTable, p.Fields[k].Name, string(col))
+			return
+		}
+		if v != nil {
+			p.Fields[k].Value = v
+		}
+	}
+
+	return
+}
+
+// Было ли поле загружено из базы или установлено
+func (p *Parent) IsLoaded(n string) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	i := p.fieldPos(n)
+	return i >= 0 && p.Fields[i]._loaded
+}
+
+// Названия загруженных полей
+func (p *Parent) LoadedFields() (names []string) {
+	p.RLock()
+	for _, f := range p.Fields {
+		if f._loaded {
+			names = append(names, f.Name)
+		}
+	}
+	p.RUnlock()
+
+	return
+}
+
+// Загружаем из базы поля, которые не были выбраны
+func (p *Parent) loadMissing() (err error) {
+	p.RLock()
+	names := []string{}
+	for _, f := range p.Fields {
+		if f.IsDb && !f._loaded {
+			names = append(names, "`"+f.Name+"`")
+		}
+	}
+
+	var pkv interface{}
+	pkLoaded := false
+	if i := p.fieldPos(p.PKey); i >= 0 {
+		pkv = p.Fields[i].Value
+		pkLoaded = p.Fields[i]._loaded
+	}
+	p.RUnlock()
+
+	if len(names) == 0 {
+		return
+	}
+	if !pkLoaded || pkv == nil {
+		err = errors.New("can not load fields without primary key: " + p.DbTable)
+		log.Println("[error]", err)
+		return
+	}
+
+	sqlrq := fmt.Sprintf(`SELECT %s FROM %s WHERE %s=?`, strings.Join(names, ", "),
+		p.GetTableName(), p.PKey)
+
+	rows, err := p.query(sqlrq, []interface{}{pkv})
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	p.Lock()
+	err = p.parseDbRow(rows, p.columnPos(columns))
+	p.Unlock()
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	return
+}
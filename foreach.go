@@ -1,7 +1,9 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -42,7 +44,7 @@ func ForeachItemInterface(fiio ForeachItemInterfaceObj) (objs []interface{}, err
 		i, err = fiio.ParseFunc(i, rows)
 		if err != nil {
 			// Если уже обработали все полученные объекты из базы
-			if err.Error() == "sql: no rows in result set" {
+			if errors.Is(err, sql.ErrNoRows) {
 				err = nil
 				break
 			}
@@ -57,62 +59,104 @@ func ForeachItemInterface(fiio ForeachItemInterfaceObj) (objs []interface{}, err
 	return
 }
 
+// With поддерживают только функции, возвращающие всю выборку
+var errWithUnsupported = errors.New("With is supported only by ForeachItemOf and ForeachItemMapOf")
+
 // Получаем группу объектов
+// Переданные параметры не изменяются
 func (p *Parent) ForeachItem(param *ForeachParam, vals ...interface{}) (rows *sql.Rows, err error) {
-	if param == nil {
-		param = &ForeachParam{}
+	return p.ForeachItemContext(context.Background(), param, vals...)
+}
+
+// Получаем группу объектов с контекстом запроса
+func (p *Parent) ForeachItemContext(ctx context.Context, param *ForeachParam, vals ...interface{}) (rows *sql.Rows, err error) {
+	// Работаем с копией чтобы параметры можно было использовать повторно
+	fp := ForeachParam{}
+	if param != nil {
+		fp = *param
+		fp.CondEntries = append([]string(nil), param.CondEntries...)
 	}
 
-	// Подчищаем переданные параметры
-	param.Clean()
+	// Связи загружаются только для всей выборки сразу
+	if len(fp.With) > 0 {
+		err = errWithUnsupported
+		log.Println("[error]", err)
+		return
+	}
 
-	// Если не указана сортировка - то по основному ключу
-	if param.OrderBy == "" {
-		param.OrderBy = p.PKey
+	// Подчищаем переданные параметры
+	err = p.cleanParam(&fp)
+	if err != nil {
+		log.Println("[error]", err)
+		return
 	}
 
 	// Если не указаны параметры для выборки - выбираем все
-	if param.Fields == "" {
-		param.Fields = p.GetFiledsString()
+	if fp.Fields == "" {
+		fp.Fields = p.GetFiledsString()
 	}
 
-	// Если не указано условие выборки - выбираем все
-	if param.Where == "" {
-		param.Where = "1"
+	// Сортировка, без группировки дополняется первичным ключом для однозначности
+	orders := fp.OrderBy
+	if fp.GroupBy == "" {
+		orders = p.pageOrders(orders)
+	} else if len(orders) == 0 {
+		orders = []Order{{Col: p.PKey}}
+	}
+	orderBy, err := orderClause(orders)
+	if err != nil {
+		log.Println("[error]", err)
+		return
 	}
 
-	// Если указан лимит - то подставляем ключевое слово
-	if param.Limit != "" {
-		param.Limit = "LIMIT " + param.Limit
+	// Продолжаем с места, на котором остановилась предыдущая страница
+	if fp.Cursor != "" {
+		if fp.GroupBy != "" {
+			err = errors.New("cursor can not be used with GROUP BY")
+			log.Println("[error]", err)
+			return
+		}
+
+		var c Cond
+		c, err = cursorCond(orders, fp.Cursor)
+		if err != nil {
+			log.Println("[error]", err)
+			return
+		}
+		fp.Filter = And(fp.Filter, c)
 	}
 
 	// Если указан GROUP BY - то подставляем ключевое слово
-	if param.GroupBy != "" {
-		param.GroupBy = "GROUP BY " + param.GroupBy
+	groupBy := ""
+	if fp.GroupBy != "" {
+		groupBy = "GROUP BY " + fp.GroupBy
 	}
 
-	// Дополнительные параметры запроса
-	where2 := "1"
-	if len(param.CondEntries) > 0 {
-		where2 = strings.Join(param.CondEntries, " AND ")
+	// Условие выборки
+	where, vals, err := p.buildWhere(&fp, vals)
+	if err != nil {
+		log.Println("[error]", err)
+		return
 	}
 
 	// строка запроса
-	sqlrq := fmt.Sprintf(`SELECT %s FROM %s WHERE (%s) AND (%s) %s ORDER BY %s %s`,
-		param.Fields, p.DbTable, param.Where, where2, param.GroupBy, param.OrderBy,
-		param.Limit)
-
-	if param.ForUpdate {
-		sqlrq += " FOR UPDATE"
-		if p.Tx == nil {
-			p.Tx = MustBegin()
+	sqlrq := fmt.Sprintf(`SELECT %s FROM %s WHERE %s %s ORDER BY %s%s`,
+		fp.Fields, p.DbTable, where, groupBy, orderBy, limitClause(fp.Limit, fp.Offset))
+
+	// Если надо залочить - нужна транзакция
+	lock := fp.lockMode()
+	sqlrq += lockClause(lock, fp.LockWait)
+	if p.Tx == nil && (lock != LockNone || fp.TxOptions != nil) {
+		p.Tx, err = beginTxx(fp.TxOptions)
+		if err != nil {
+			return
 		}
 	}
 
 	if p.Tx != nil {
-		rows, err = p.Tx.Query(sqlrq, vals...)
+		rows, err = p.Tx.QueryContext(ctx, sqlrq, vals...)
 	} else {
-		rows, err = Dbh.Query(sqlrq, vals...)
+		rows, err = Dbh.QueryContext(ctx, sqlrq, vals...)
 	}
 	if err != nil {
 		log.Println("[error]", err)
@@ -121,3 +165,167 @@ func (p *Parent) ForeachItem(param *ForeachParam, vals ...interface{}) (rows *sq
 
 	return
 }
+
+// Формируем условие выборки по параметрам
+// Значения из Filter добавляются после переданных значений
+func (p *Parent) buildWhere(param *ForeachParam, vals []interface{}) (where string, args []interface{}, err error) {
+	where = param.Where
+	if where == "" {
+		where = "1"
+	}
+
+	// Дополнительные параметры запроса
+	conds := make([]string, len(param.CondEntries), len(param.CondEntries)+1)
+	copy(conds, param.CondEntries)
+
+	args = make([]interface{}, len(vals))
+	copy(args, vals)
+
+	// Условие из конструктора
+	if !param.Filter.IsEmpty() {
+		var fs string
+		var fa []interface{}
+		fs, fa, err = param.Filter.SQL()
+		if err != nil {
+			return
+		}
+
+		conds = append(conds, fs)
+		args = append(args, fa...)
+	}
+
+	// Исключаем мягко удаленные записи
+	if !param.WithDeleted && p.SoftDelete != "" {
+		conds = append(conds, p.softDeleteCond())
+	}
+
+	where2 := "1"
+	if len(conds) > 0 {
+		where2 = strings.Join(conds, " AND ")
+	}
+
+	where = "(" + where + ") AND (" + where2 + ")"
+	return
+}
+
+// Объект который можно получить группой через ForeachItemOf
+// Реализуется любой структурой со встроенным Parent
+type Item interface {
+	DbParent() *Parent
+}
+
+// Родительский объект для ForeachItemOf
+func (p *Parent) DbParent() *Parent {
+	return p
+}
+
+// Получаем группу объектов в виде типизированного среза
+func ForeachItemOf[T Item](newFunc func(*InitObj) (T, error), param *ForeachParam, vals ...interface{}) (objs []T, err error) {
+	err = foreachOf(newFunc, param, vals, func(obj T) error {
+		objs = append(objs, obj)
+		return nil
+	})
+	if err != nil || param == nil {
+		return
+	}
+
+	// Загружаем связи
+	err = loadRelationsOf(objs, param.With)
+	return
+}
+
+// Получаем группу объектов в виде хэша по первичному ключу
+func ForeachItemMapOf[K comparable, T Item](newFunc func(*InitObj) (T, error), param *ForeachParam, vals ...interface{}) (objs map[K]T, err error) {
+	objs = make(map[K]T)
+	err = foreachOf(newFunc, param, vals, func(obj T) error {
+		p := obj.DbParent()
+		k, ok := p.Get(p.PKey).(K)
+		if !ok {
+			return fmt.Errorf("bad primary key type %T for %s", p.Get(p.PKey), p.DbTable)
+		}
+
+		objs[k] = obj
+		return nil
+	})
+	if err != nil || param == nil || len(param.With) == 0 {
+		return
+	}
+
+	// Загружаем связи
+	list := make([]T, 0, len(objs))
+	for _, o := range objs {
+		list = append(list, o)
+	}
+	err = loadRelationsOf(list, param.With)
+	return
+}
+
+// Перебираем объекты созданные конструктором
+func foreachOf[T Item](newFunc func(*InitObj) (T, error), param *ForeachParam, vals []interface{}, fn func(T) error) (err error) {
+	// Создаем объект для выборки
+	t, err := newFunc(nil)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	// Связи загружает вызывающий после выборки
+	var fp *ForeachParam
+	if param != nil {
+		cp := *param
+		cp.With = nil
+		fp = &cp
+	}
+
+	rows, err := t.DbParent().ForeachItem(fp, vals...)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		return
+	}
+
+	// Транзакция могла начаться при выборке
+	tx := t.DbParent().Tx
+
+	// Позиции полей одинаковы для всех строк
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+	pos := t.DbParent().columnPos(columns)
+
+	for {
+		var obj T
+		obj, err = newFunc(&InitObj{Tx: tx, Empty: true})
+		if err != nil {
+			log.Println("[error]", err)
+			return
+		}
+
+		err = obj.DbParent().parseDbRow(rows, pos)
+		if err != nil {
+			// Если уже обработали все полученные объекты из базы
+			if errors.Is(err, sql.ErrNoRows) {
+				err = nil
+				break
+			}
+			log.Println("[error]", err)
+			return
+		}
+
+		err = obj.DbParent().runHooks(AfterLoad)
+		if err != nil {
+			return
+		}
+
+		err = fn(obj)
+		if err != nil {
+			log.Println("[error]", err)
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"log"
+)
+
+// Момент вызова обработчика
+type HookEvent int
+
+const (
+	// Перед вставкой и перед обновлением
+	BeforeSave HookEvent = iota
+	AfterSave
+	BeforeInsert
+	AfterInsert
+	BeforeUpdate
+	AfterUpdate
+	BeforeDelete
+	AfterDelete
+	// После чтения записи из базы
+	AfterLoad
+)
+
+// Обработчик событий объекта
+// Ошибка в Before* отменяет операцию. After* вызываются после коммита
+// (или после выполнения запросов, если транзакцию коммитит вызывающий)
+// и не могут отменить операцию - их ошибка только возвращается вызывающему
+// При сохранении обработчики вызываются, только если есть что записать;
+// первичный ключ и времена создания и обновления к этому моменту уже заполнены
+type HookFunc func(ctx context.Context, p *Parent) error
+
+// Добавляем обработчик события
+func (p *Parent) AddHook(ev HookEvent, fn HookFunc) {
+	p.Lock()
+	// Карта копируется, так как ее делят объекты созданные через NewItem
+	hooks := make(map[HookEvent][]HookFunc, len(p.hooks)+1)
+	for k, v := range p.hooks {
+		hooks[k] = v
+	}
+	hooks[ev] = append(hooks[ev][:len(hooks[ev]):len(hooks[ev])], fn)
+	p.hooks = hooks
+	p.Unlock()
+}
+
+// Вызываем обработчики событий по порядку
+func (p *Parent) runHooks(evs ...HookEvent) (err error) {
+	p.RLock()
+	hooks := p.hooks
+	p.RUnlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for _, ev := range evs {
+		for _, fn := range hooks[ev] {
+			err = fn(ctx, p)
+			if err != nil {
+				log.Println("[error]", err)
+				return
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iter"
+)
+
+// Новый пустой объект той же таблицы
+// Описание полей копируется, значения не переносятся
+func (p *Parent) NewItem() *Parent {
+	p.RLock()
+	fields := make([]Field, len(p.Fields))
+	for i, f := range p.Fields {
+		fields[i] = Field{
+			Name:        f.Name,
+			Type:        f.Type,
+			IsJson:      f.IsJson,
+			IsDb:        f.IsDb,
+			Null:        f.Null,
+			AutoCreated: f.AutoCreated,
+			AutoUpdated: f.AutoUpdated,
+			IsUUID:      f.IsUUID,
+		}
+	}
+	p.RUnlock()
+
+	n := &Parent{
+		Fields:          fields,
+		DbTable:         p.DbTable,
+		PKey:            p.PKey,
+		SKeys:           p.SKeys,
+		MapAddFunc:      p.MapAddFunc,
+		MapVersionFunc:  p.MapVersionFunc,
+		Tx:              p.Tx,
+		txManaged:       p.txManaged,
+		SoftDelete:      p.SoftDelete,
+		CreatedField:    p.CreatedField,
+		UpdatedField:    p.UpdatedField,
+		Relations:       p.Relations,
+		LazyLoad:        p.LazyLoad,
+		RefreshOnCommit: p.RefreshOnCommit,
+		RefreshOnInsert: p.RefreshOnInsert,
+		PKStrategy:      p.PKStrategy,
+		PKFunc:          p.PKFunc,
+		Audit:           p.Audit,
+		ctx:             p.ctx,
+		hooks:           p.hooks,
+	}
+	n.fieldIdx.Store(p.fieldIdx.Load())
+
+	return n
+}
+
+// Перебор объектов по одному без загрузки всей выборки в память
+//
+//	for obj, err := range table.Iter(ctx, param) {
+//		...
+//	}
+//
+// При выходе из цикла выборка закрывается. Ошибка отдается последним элементом
+func (p *Parent) Iter(ctx context.Context, param *ForeachParam, vals ...interface{}) iter.Seq2[*Parent, error] {
+	return func(yield func(*Parent, error) bool) {
+		rows, err := p.ForeachItemContext(ctx, param, vals...)
+		if rows != nil {
+			defer rows.Close()
+		}
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// Позиции полей одинаковы для всех строк
+		columns, err := rows.Columns()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		pos := p.columnPos(columns)
+
+		for {
+			obj := p.NewItem()
+
+			err = obj.parseDbRow(rows, pos)
+			if errors.Is(err, sql.ErrNoRows) {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			err = obj.runHooks(AfterLoad)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if !yield(obj, nil) {
+				return
+			}
+		}
+	}
+}
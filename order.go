@@ -0,0 +1,158 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Сортировка по колонке
+type Order struct {
+	Col  string
+	Desc bool
+}
+
+// Сортировка по возрастанию
+func Asc(col string) Order {
+	return Order{Col: col}
+}
+
+// Сортировка по убыванию
+func Desc(col string) Order {
+	return Order{Col: col, Desc: true}
+}
+
+// Формируем строку сортировки
+func orderClause(orders []Order) (s string, err error) {
+	parts := make([]string, len(orders))
+	for i, o := range orders {
+		parts[i], err = quoteColumn(o.Col)
+		if err != nil {
+			return
+		}
+
+		if o.Desc {
+			parts[i] += " DESC"
+		}
+	}
+
+	s = strings.Join(parts, ", ")
+	return
+}
+
+// Формируем ограничение выборки
+func limitClause(limit, offset int) string {
+	if limit <= 0 && offset <= 0 {
+		return ""
+	}
+
+	// Без лимита MySQL не принимает OFFSET
+	if limit <= 0 {
+		return fmt.Sprintf(" LIMIT 18446744073709551615 OFFSET %d", offset)
+	}
+	if offset <= 0 {
+		return fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+}
+
+// Сортировка для постраничной выборки - всегда заканчивается первичным ключом
+func (p *Parent) pageOrders(orders []Order) []Order {
+	for _, o := range orders {
+		if o.Col == p.PKey {
+			return orders
+		}
+	}
+
+	desc := false
+	if len(orders) > 0 {
+		desc = orders[len(orders)-1].Desc
+	}
+
+	res := make([]Order, len(orders), len(orders)+1)
+	copy(res, orders)
+	return append(res, Order{Col: p.PKey, Desc: desc})
+}
+
+// Время в токене с долями секунды, иначе записи DATETIME(6) внутри одной секунды пропускаются
+const cursorTimeFormat = "2006-01-02 15:04:05.999999"
+
+// Токен следующей страницы по значениям объекта
+// Вызывается для последнего полученного объекта страницы
+func (p *Parent) NextCursor(param *ForeachParam) (token string, err error) {
+	var orders []Order
+	if param != nil {
+		orders = param.OrderBy
+	}
+	orders = p.pageOrders(orders)
+
+	vals := make([]interface{}, len(orders))
+	for i, o := range orders {
+		v := p.Get(o.Col)
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(cursorTimeFormat)
+		}
+		vals[i] = v
+	}
+
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(vals)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	return
+}
+
+// Условие для выборки записей после токена
+func cursorCond(orders []Order, token string) (c Cond, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		err = errors.New("bad cursor: " + err.Error())
+		return
+	}
+
+	var vals []interface{}
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&vals)
+	if err != nil {
+		err = errors.New("bad cursor: " + err.Error())
+		return
+	}
+
+	if len(vals) != len(orders) {
+		err = errors.New("cursor does not match order")
+		return
+	}
+
+	// (a > ?) OR (a = ? AND b > ?) OR ...
+	ors := make([]Cond, len(orders))
+	for i, o := range orders {
+		ands := make([]Cond, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, Eq(orders[j].Col, vals[j]))
+		}
+
+		if vals[i] == nil {
+			err = errors.New("cursor value is NULL: " + o.Col)
+			return
+		}
+
+		if o.Desc {
+			ands = append(ands, Lt(o.Col, vals[i]))
+		} else {
+			ands = append(ands, Gt(o.Col, vals[i]))
+		}
+		ors[i] = And(ands...)
+	}
+
+	c = Or(ors...)
+	return
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderClause(t *testing.T) {
+	s, err := orderClause([]Order{Desc("created"), Asc("t.id")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "`created` DESC, `t`.`id`" {
+		t.Fatalf("order: %q", s)
+	}
+
+	if _, err = orderClause([]Order{Asc("id DESC; --")}); err == nil {
+		t.Fatal("expected error for bad column")
+	}
+}
+
+func TestLimitClause(t *testing.T) {
+	for _, tc := range []struct {
+		limit, offset int
+		want          string
+	}{
+		{0, 0, ""},
+		{-1, -1, ""},
+		{10, 0, " LIMIT 10"},
+		{10, 20, " LIMIT 10 OFFSET 20"},
+		{0, 20, " LIMIT 18446744073709551615 OFFSET 20"},
+	} {
+		if s := limitClause(tc.limit, tc.offset); s != tc.want {
+			t.Errorf("limitClause(%d, %d) = %q, want %q", tc.limit, tc.offset, s, tc.want)
+		}
+	}
+}
+
+func TestCursorCond(t *testing.T) {
+	p := &Parent{
+		PKey: "id",
+		Fields: []Field{
+			{Name: "id", Type: "int64", Value: int64(42), IsDb: true},
+			{Name: "score", Type: "int", Value: 7, IsDb: true},
+			{Name: "created", Type: "time.Time", Value: time.Date(2024, 5, 1, 10, 20, 30, 123456000, time.UTC), IsDb: true},
+		},
+	}
+
+	param := &ForeachParam{OrderBy: []Order{Desc("score"), Asc("created")}}
+	token, err := p.NextCursor(param)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orders := p.pageOrders(param.OrderBy)
+	c, err := cursorCond(orders, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sql, args, err := c.SQL()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Первичный ключ добавлен с направлением последней колонки
+	want := "((`score`<?)) OR ((`score`=?) AND (`created`>?)) OR ((`score`=?) AND (`created`=?) AND (`id`>?))"
+	if sql != want {
+		t.Fatalf("cursor sql:\n%s\nwant:\n%s", sql, want)
+	}
+
+	ts := "2024-05-01 10:20:30.123456"
+	wantArgs := []interface{}{7, 7, ts, 7, ts, int64(42)}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("cursor args %#v, want %#v", args, wantArgs)
+	}
+}
+
+func TestCursorCondErrors(t *testing.T) {
+	orders := []Order{Asc("id")}
+	if _, err := cursorCond(orders, "not base64!"); err == nil {
+		t.Error("expected error for bad token")
+	}
+	if _, err := cursorCond(orders, "AAAA"); err == nil {
+		t.Error("expected error for bad gob")
+	}
+
+	p := &Parent{PKey: "id", Fields: []Field{{Name: "id", Type: "int", Value: 1, IsDb: true}}}
+	token, err := p.NextCursor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cursorCond([]Order{Asc("a"), Asc("id")}, token); err == nil {
+		t.Error("expected error for order mismatch")
+	}
+}
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Способ получения первичного ключа при вставке
+type PKStrategy int
+
+const (
+	// Ключ назначает база
+	PKAutoIncrement PKStrategy = iota
+	// Случайный UUID версии 4
+	PKUUIDv4
+	// UUID версии 7, упорядоченный по времени
+	PKUUIDv7
+	// ULID, упорядоченный по времени
+	PKULID
+	// Ключ возвращает PKFunc
+	PKCustom
+)
+
+// Алфавит Crockford base32 для ULID
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Новый UUID версии 4
+func NewUUIDv4() (u [16]byte) {
+	_, err := rand.Read(u[:])
+	if err != nil {
+		log.Fatalln("[fatal]", err)
+	}
+
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return
+}
+
+// Новый UUID версии 7
+func NewUUIDv7() (u [16]byte) {
+	_, err := rand.Read(u[6:])
+	if err != nil {
+		log.Fatalln("[fatal]", err)
+	}
+
+	putMillis(u[:6], time.Now())
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+	return
+}
+
+// Новый ULID
+func NewULID() (u [16]byte) {
+	_, err := rand.Read(u[6:])
+	if err != nil {
+		log.Fatalln("[fatal]", err)
+	}
+
+	putMillis(u[:6], time.Now())
+	return
+}
+
+// Записываем 48 бит миллисекунд
+func putMillis(b []byte, t time.Time) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(t.UnixMilli()))
+	copy(b, buf[2:])
+}
+
+// UUID в виде xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func FormatUUID(b []byte) string {
+	if len(b) != 16 {
+		return hex.EncodeToString(b)
+	}
+
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// Разбираем UUID из строки
+func ParseUUID(s string) (b []byte, err error) {
+	b, err = hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err == nil && len(b) != 16 {
+		err = errors.New("bad uuid length")
+	}
+	if err != nil {
+		err = fmt.Errorf("bad uuid %q: %w", s, err)
+	}
+
+	return
+}
+
+// ULID в виде 26 символов base32
+func FormatULID(b []byte) string {
+	if len(b) != 16 {
+		return hex.EncodeToString(b)
+	}
+
+	// 128 бит кодируются 26 символами по 5 бит, старшие 2 бита первого символа нулевые
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = ulidAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out)
+}
+
+// Разбираем ULID из строки
+func ParseULID(s string) (b []byte, err error) {
+	if len(s) != 26 {
+		err = fmt.Errorf("bad ulid %q: bad length", s)
+		return
+	}
+
+	// Первый символ несет только 3 бита, иначе значение не помещается в 128 бит
+	if s[0] > '7' {
+		err = fmt.Errorf("bad ulid %q: overflow", s)
+		return
+	}
+
+	var hi, lo uint64
+	for _, c := range strings.ToUpper(s) {
+		i := strings.IndexRune(ulidAlphabet, c)
+		if i < 0 {
+			err = fmt.Errorf("bad ulid %q: bad symbol %q", s, c)
+			return
+		}
+
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(i)
+	}
+
+	b = make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+	return
+}
+
+// Генерируем первичный ключ для новой записи в формате поля
+func (p *Parent) generatePK(typ string) (v interface{}, err error) {
+	var u [16]byte
+	switch p.PKStrategy {
+	case PKCustom:
+		if p.PKFunc == nil {
+			err = errors.New("PKFunc is not set for " + p.DbTable)
+			return
+		}
+		return p.PKFunc()
+	case PKUUIDv4:
+		u = NewUUIDv4()
+	case PKUUIDv7:
+		u = NewUUIDv7()
+	case PKULID:
+		u = NewULID()
+	default:
+		return
+	}
+
+	// binary(16) или строка
+	switch typ {
+	case "[]uint8":
+		v = u[:]
+	case "string":
+		if p.PKStrategy == PKULID {
+			v = FormatULID(u[:])
+		} else {
+			v = FormatUUID(u[:])
+		}
+	default:
+		err = fmt.Errorf("bad primary key type %s for %s", typ, p.DbTable)
+	}
+
+	return
+}
+
+// Назначаем первичный ключ перед вставкой, если он не указан
+// PKFunc вызывается без блокировки объекта, он может читать его поля
+func (p *Parent) fillPK() (err error) {
+	if p.Existed || p.PKStrategy == PKAutoIncrement {
+		return
+	}
+
+	p.RLock()
+	i := p.fieldPos(p.PKey)
+	var typ string
+	empty := false
+	if i >= 0 {
+		typ = p.Fields[i].Type
+		empty = emptyPK(p.Fields[i].Value)
+	}
+	p.RUnlock()
+
+	if !empty {
+		return
+	}
+
+	v, err := p.generatePK(typ)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	// Ключ могли указать, пока он генерировался
+	i = p.fieldPos(p.PKey)
+	if i < 0 || !emptyPK(p.Fields[i].Value) {
+		return
+	}
+
+	f := &p.Fields[i]
+	f.markDirty()
+	f.Value = v
+	f._special_value = ""
+	f._loaded = true
+	return
+}
+
+// Значение ключа не указано
+func emptyPK(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []byte:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+// Строковое представление бинарного ключа для json
+func (p *Parent) formatKey(f *Field) (interface{}, bool) {
+	b, ok := f.Value.([]byte)
+	if !ok || len(b) != 16 {
+		return nil, false
+	}
+
+	if f.Name == p.PKey {
+		switch p.PKStrategy {
+		case PKUUIDv4, PKUUIDv7:
+			return FormatUUID(b), true
+		case PKULID:
+			return FormatULID(b), true
+		}
+	}
+
+	if f.IsUUID {
+		return FormatUUID(b), true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestULIDRoundTrip(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		u := NewULID()
+		s := FormatULID(u[:])
+		if len(s) != 26 {
+			t.Fatalf("bad ulid length %d: %s", len(s), s)
+		}
+
+		b, err := ParseULID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, u[:]) {
+			t.Fatalf("ulid %s: got %x, want %x", s, b, u)
+		}
+
+		// Регистр не важен
+		b, err = ParseULID(strings.ToLower(s))
+		if err != nil || !bytes.Equal(b, u[:]) {
+			t.Fatalf("lower ulid %s: got %x, %v", s, b, err)
+		}
+	}
+
+	max := bytes.Repeat([]byte{0xff}, 16)
+	if s := FormatULID(max); s != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Fatalf("max ulid: %s", s)
+	}
+}
+
+func TestParseULIDErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"01ARZ3NDEKTSV4RRFFQ69G5FA",
+		"01ARZ3NDEKTSV4RRFFQ69G5FAVV",
+		"01ARZ3NDEKTSV4RRFFQ69G5FAU",
+		"8ZZZZZZZZZZZZZZZZZZZZZZZZZ",
+		"ZZZZZZZZZZZZZZZZZZZZZZZZZZ",
+	} {
+		if _, err := ParseULID(s); err == nil {
+			t.Errorf("ParseULID(%q): expected error", s)
+		}
+	}
+}
+
+func TestUUIDRoundTrip(t *testing.T) {
+	for _, u := range [][16]byte{NewUUIDv4(), NewUUIDv7()} {
+		s := FormatUUID(u[:])
+		if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			t.Fatalf("bad uuid format: %s", s)
+		}
+
+		b, err := ParseUUID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, u[:]) {
+			t.Fatalf("uuid %s: got %x, want %x", s, b, u)
+		}
+	}
+
+	u := NewUUIDv7()
+	if u[6]>>4 != 7 || u[8]>>6 != 2 {
+		t.Fatalf("bad uuid v7 version or variant: %x", u)
+	}
+
+	if _, err := ParseUUID("not-a-uuid"); err == nil {
+		t.Fatal("expected error for bad uuid")
+	}
+}
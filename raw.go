@@ -0,0 +1,214 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Разделитель между префиксом объекта и названием поля в колонках запроса
+const RawPrefixSep = "__"
+
+// Куда раскладывать колонки произвольного запроса
+type RawTarget struct {
+	// Колонки вида prefix__field попадают в этот объект, с пустым префиксом - колонки без префикса
+	Prefix string
+	// Описание объекта, для каждой строки создается новый через NewItem
+	Obj *Parent
+}
+
+// Описание для строки без таблицы с указанными типами колонок
+// Типы те же, что и у полей: int, int64, float64, string, []uint8, time.Time
+func NewRow(types map[string]string) *Parent {
+	p := &Parent{}
+	for name, typ := range types {
+		p.AddField(Field{Name: name, Type: typ, IsDb: true, IsJson: true})
+	}
+
+	return p
+}
+
+// Соответствие колонки результата полю объекта
+type rawColumn struct {
+	target int
+	field  int
+}
+
+// Разбор колонок результата по объектам
+type RawParser struct {
+	targets []RawTarget
+	columns []rawColumn
+}
+
+// Готовим разбор колонок результата, для неизвестных колонок возвращается ошибка
+func NewRawParser(rows *sql.Rows, targets ...RawTarget) (rp *RawParser, err error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	rp = &RawParser{targets: targets, columns: make([]rawColumn, len(columns))}
+	unknown := []string{}
+
+	for i, col := range columns {
+		rc, ok := rp.resolve(col)
+		if !ok {
+			unknown = append(unknown, col)
+			continue
+		}
+		rp.columns[i] = rc
+	}
+
+	if len(unknown) > 0 {
+		err = fmt.Errorf("unknown columns in result: %s", strings.Join(unknown, ", "))
+		log.Println("[error]", err)
+		return nil, err
+	}
+
+	return
+}
+
+// Ищем объект и поле для колонки
+func (rp *RawParser) resolve(col string) (rc rawColumn, ok bool) {
+	prefix, name := "", col
+	if i := strings.Index(col, RawPrefixSep); i > 0 {
+		prefix, name = col[:i], col[i+len(RawPrefixSep):]
+	}
+
+	for t, target := range rp.targets {
+		if target.Prefix != prefix {
+			continue
+		}
+
+		if f := rawFieldPos(target.Obj, name); f >= 0 {
+			return rawColumn{target: t, field: f}, true
+		}
+	}
+
+	// Колонка с разделителем в названии может быть обычным полем
+	if prefix != "" {
+		for t, target := range rp.targets {
+			if target.Prefix != "" {
+				continue
+			}
+
+			if f := rawFieldPos(target.Obj, col); f >= 0 {
+				return rawColumn{target: t, field: f}, true
+			}
+		}
+	}
+
+	return
+}
+
+// Позиция поля из базы, как в columnPos
+func rawFieldPos(p *Parent, name string) int {
+	i := p.fieldPos(name)
+	if i >= 0 && !p.Fields[i].IsDb {
+		return -1
+	}
+
+	return i
+}
+
+// Читаем следующую строку, объекты возвращаются в порядке targets
+// Когда строки закончились возвращается sql.ErrNoRows
+func (rp *RawParser) Next(rows *sql.Rows) (objs []*Parent, err error) {
+	if !rows.Next() {
+		err = rows.Err()
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return
+	}
+
+	values := make([]sql.RawBytes, len(rp.columns))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	err = rows.Scan(scanArgs...)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	objs = make([]*Parent, len(rp.targets))
+	for i, t := range rp.targets {
+		objs[i] = t.Obj.NewItem()
+	}
+
+	for i, col := range values {
+		rc := rp.columns[i]
+		obj := objs[rc.target]
+		f := &obj.Fields[rc.field]
+		f._loaded = true
+
+		if col == nil {
+			continue
+		}
+
+		// Запись существует, только если выбран ее первичный ключ
+		// При LEFT JOIN без совпадения ключ будет NULL
+		if f.Name == obj.PKey && obj.DbTable != "" {
+			obj.Existed = true
+		}
+
+		var v interface{}
+		v, err = parseValue(f.Type, col)
+		if err != nil {
+			log.Println("[error]", err, objs[rc.target].DbTable, f.Name, string(col))
+			return
+		}
+		if v != nil {
+			f.Value = v
+		}
+	}
+
+	return
+}
+
+// Выполняем произвольный запрос и раскладываем все строки по объектам
+// Каждый элемент результата - объекты одной строки в порядке targets
+func QueryRaw(tx *sqlx.Tx, targets []RawTarget, sqlrq string, vals ...interface{}) (res [][]*Parent, err error) {
+	var rows *sql.Rows
+	if tx != nil {
+		rows, err = tx.Query(sqlrq, vals...)
+	} else {
+		rows, err = Dbh.Query(sqlrq, vals...)
+	}
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	rp, err := NewRawParser(rows, targets...)
+	if err != nil {
+		return
+	}
+
+	for {
+		var objs []*Parent
+		objs, err = rp.Next(rows)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+
+		res = append(res, objs)
+	}
+
+	return
+}
@@ -0,0 +1,389 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Тип связи между таблицами
+type RelationKind int
+
+const (
+	// Объект ссылается на одну запись другой таблицы
+	BelongsTo RelationKind = iota
+	// Записи другой таблицы ссылаются на объект
+	HasMany
+	// Связь через промежуточную таблицу
+	ManyToMany
+)
+
+// Описание связи с другой таблицей
+type Relation struct {
+	// Название связи, под ним связанные объекты попадают в GetMap и GetJson
+	Name string
+	Kind RelationKind
+	// Описание связанной таблицы
+	Target *Parent
+	// BelongsTo: LocalKey - колонка этой таблицы, ForeignKey - колонка Target (по умолчанию первичный ключ)
+	// HasMany: LocalKey - колонка этой таблицы (по умолчанию первичный ключ), ForeignKey - колонка Target
+	LocalKey   string
+	ForeignKey string
+	// ManyToMany: промежуточная таблица и ее колонки со ссылками на эту таблицу и на Target
+	Through        string
+	ThroughLocal   string
+	ThroughForeign string
+	// Дополнительное условие для связанных записей
+	Param *ForeachParam
+}
+
+// Добавляем связь
+// Ключи, без которых связь не загрузить, проверяются сразу
+func (p *Parent) AddRelation(r Relation) (err error) {
+	err = r.check()
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	p.Relations = append(p.Relations, r)
+	return
+}
+
+// Проверяем описание связи
+func (r *Relation) check() error {
+	if r.Name == "" {
+		return errors.New("relation name is empty")
+	}
+	if r.Target == nil {
+		return errors.New("relation target is nil: " + r.Name)
+	}
+
+	switch r.Kind {
+	case BelongsTo:
+		if r.LocalKey == "" {
+			return errors.New("belongs-to relation requires LocalKey: " + r.Name)
+		}
+	case HasMany:
+		if r.ForeignKey == "" {
+			return errors.New("has-many relation requires ForeignKey: " + r.Name)
+		}
+	case ManyToMany:
+		if r.Through == "" || r.ThroughLocal == "" || r.ThroughForeign == "" {
+			return errors.New("many-to-many relation requires Through, ThroughLocal and ThroughForeign: " + r.Name)
+		}
+	default:
+		return fmt.Errorf("bad relation kind %d: %s", r.Kind, r.Name)
+	}
+
+	return nil
+}
+
+// Получаем загруженный объект связи BelongsTo
+func (p *Parent) RelatedOne(name string) *Parent {
+	p.RLock()
+	defer p.RUnlock()
+
+	o, _ := p.related[name].(*Parent)
+	return o
+}
+
+// Получаем загруженные объекты связи HasMany или ManyToMany
+func (p *Parent) RelatedMany(name string) []*Parent {
+	p.RLock()
+	defer p.RUnlock()
+
+	o, _ := p.related[name].([]*Parent)
+	return o
+}
+
+// Загружены ли объекты связи
+func (p *Parent) IsRelatedLoaded(name string) bool {
+	p.RLock()
+	defer p.RUnlock()
+
+	_, ok := p.related[name]
+	return ok
+}
+
+// Загружаем связи объекта
+func (p *Parent) LoadRelations(names ...string) error {
+	return LoadRelations([]*Parent{p}, names...)
+}
+
+// Загружаем связи для группы объектов одной таблицы
+// На каждую связь выполняется один запрос с IN по ключам всех объектов
+func LoadRelations(objs []*Parent, names ...string) (err error) {
+	if len(objs) == 0 {
+		return
+	}
+
+	for _, name := range names {
+		var r *Relation
+		for i := range objs[0].Relations {
+			if objs[0].Relations[i].Name == name {
+				r = &objs[0].Relations[i]
+				break
+			}
+		}
+		if r == nil {
+			err = errors.New("unknown relation: " + name)
+			log.Println("[error]", err)
+			return
+		}
+
+		switch r.Kind {
+		case BelongsTo:
+			err = loadBelongsTo(objs, r)
+		case HasMany:
+			err = loadHasMany(objs, r)
+		case ManyToMany:
+			err = loadManyToMany(objs, r)
+		default:
+			err = fmt.Errorf("bad relation kind %d: %s", r.Kind, name)
+			log.Println("[error]", err)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Загружаем связи для объектов полученных через ForeachItemOf
+func loadRelationsOf[T Item](objs []T, names []string) error {
+	if len(names) == 0 || len(objs) == 0 {
+		return nil
+	}
+
+	ps := make([]*Parent, len(objs))
+	for i, o := range objs {
+		ps[i] = o.DbParent()
+	}
+
+	return LoadRelations(ps, names...)
+}
+
+func loadBelongsTo(objs []*Parent, r *Relation) (err error) {
+	fk := r.ForeignKey
+	if fk == "" {
+		fk = r.Target.PKey
+	}
+
+	keys := relationKeys(objs, r.LocalKey)
+	targets, err := loadRelated(r, fk, keys)
+	if err != nil {
+		return
+	}
+
+	idx := make(map[string]*Parent, len(targets))
+	for _, t := range targets {
+		idx[relationKey(t.Get(fk))] = t
+	}
+
+	for _, o := range objs {
+		o.setRelated(r.Name, idx[relationKey(o.Get(r.LocalKey))])
+	}
+
+	return
+}
+
+func loadHasMany(objs []*Parent, r *Relation) (err error) {
+	lk := r.LocalKey
+	if lk == "" {
+		lk = objs[0].PKey
+	}
+
+	keys := relationKeys(objs, lk)
+	targets, err := loadRelated(r, r.ForeignKey, keys)
+	if err != nil {
+		return
+	}
+
+	idx := make(map[string][]*Parent)
+	for _, t := range targets {
+		k := relationKey(t.Get(r.ForeignKey))
+		idx[k] = append(idx[k], t)
+	}
+
+	for _, o := range objs {
+		list := idx[relationKey(o.Get(lk))]
+		if list == nil {
+			list = []*Parent{}
+		}
+		o.setRelated(r.Name, list)
+	}
+
+	return
+}
+
+func loadManyToMany(objs []*Parent, r *Relation) (err error) {
+	pk := objs[0].PKey
+	keys := relationKeys(objs, pk)
+
+	// Читаем промежуточную таблицу
+	links := make(map[string][]string)
+	foreign := []interface{}{}
+	seen := make(map[string]bool)
+
+	if len(keys) > 0 {
+		var sqlrq string
+		var vals []interface{}
+		sqlrq, vals, err = linkQuery(r, keys)
+		if err != nil {
+			log.Println("[error]", err)
+			return
+		}
+
+		rows, e := objs[0].query(sqlrq, vals)
+		if rows != nil {
+			defer rows.Close()
+		}
+		if e != nil {
+			err = e
+			log.Println("[error]", err)
+			return
+		}
+
+		for rows.Next() {
+			var l, f []byte
+			err = rows.Scan(&l, &f)
+			if err != nil {
+				log.Println("[error]", err)
+				return
+			}
+
+			links[string(l)] = append(links[string(l)], string(f))
+			if !seen[string(f)] {
+				seen[string(f)] = true
+				foreign = append(foreign, string(f))
+			}
+		}
+		err = rows.Err()
+		if err != nil {
+			log.Println("[error]", err)
+			return
+		}
+	}
+
+	targets, err := loadRelated(r, r.Target.PKey, foreign)
+	if err != nil {
+		return
+	}
+
+	idx := make(map[string]*Parent, len(targets))
+	for _, t := range targets {
+		idx[relationKey(t.Get(r.Target.PKey))] = t
+	}
+
+	for _, o := range objs {
+		list := []*Parent{}
+		for _, f := range links[relationKey(o.Get(pk))] {
+			if t, ok := idx[f]; ok {
+				list = append(list, t)
+			}
+		}
+		o.setRelated(r.Name, list)
+	}
+
+	return
+}
+
+// Запрос к промежуточной таблице
+func linkQuery(r *Relation, keys []interface{}) (sqlrq string, vals []interface{}, err error) {
+	lc, err := quoteColumn(r.ThroughLocal)
+	if err != nil {
+		return
+	}
+	fc, err := quoteColumn(r.ThroughForeign)
+	if err != nil {
+		return
+	}
+	if !columnNameReg.MatchString(r.Through) {
+		err = errors.New("bad table name: " + r.Through)
+		return
+	}
+
+	where, vals, err := In(r.ThroughLocal, keys).SQL()
+	if err != nil {
+		return
+	}
+
+	sqlrq = fmt.Sprintf("SELECT %s, %s FROM `%s` WHERE %s", lc, fc,
+		strings.Replace(r.Through, ".", "`.`", 1), where)
+	return
+}
+
+// Загружаем связанные записи по списку ключей
+func loadRelated(r *Relation, col string, keys []interface{}) (objs []*Parent, err error) {
+	if len(keys) == 0 {
+		return
+	}
+
+	fp := ForeachParam{}
+	if r.Param != nil {
+		fp = *r.Param
+	}
+	fp.Filter = And(fp.Filter, In(col, keys))
+
+	// Вложенные связи загружаем после выборки, Iter их не поддерживает
+	with := fp.With
+	fp.With = nil
+
+	for obj, e := range r.Target.NewItem().Iter(context.Background(), &fp) {
+		if e != nil {
+			err = e
+			return
+		}
+
+		objs = append(objs, obj)
+	}
+
+	// Вложенные связи
+	if len(with) > 0 {
+		err = LoadRelations(objs, with...)
+	}
+
+	return
+}
+
+// Уникальные значения колонки у группы объектов
+func relationKeys(objs []*Parent, col string) (keys []interface{}) {
+	seen := make(map[string]bool)
+	for _, o := range objs {
+		v := o.Get(col)
+		if v == nil {
+			continue
+		}
+
+		k := relationKey(v)
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, v)
+		}
+	}
+
+	return
+}
+
+// Приводим значение ключа к строке для сравнения значений разных типов
+func relationKey(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// Сохраняем загруженную связь
+func (p *Parent) setRelated(name string, v interface{}) {
+	p.Lock()
+	if p.related == nil {
+		p.related = make(map[string]interface{})
+	}
+	p.related[name] = v
+	p.Unlock()
+}
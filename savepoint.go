@@ -0,0 +1,83 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Создаем точку сохранения
+func (tx *Tx) Savepoint(name string) (err error) {
+	return tx.savepointExec("SAVEPOINT", name)
+}
+
+// Откатываемся к точке сохранения, транзакция при этом продолжается
+func (tx *Tx) RollbackTo(name string) (err error) {
+	return tx.savepointExec("ROLLBACK TO SAVEPOINT", name)
+}
+
+// Удаляем точку сохранения, изменения после нее остаются в транзакции
+func (tx *Tx) ReleaseSavepoint(name string) (err error) {
+	return tx.savepointExec("RELEASE SAVEPOINT", name)
+}
+
+// Выполняем функцию во вложенной транзакции
+// При ошибке или панике откатываются только изменения сделанные внутри функции,
+// объекты присоединенные внутри нее возвращаются в исходное состояние
+func (tx *Tx) Nested(fn func(tx *Tx) error) (err error) {
+	tx.savepoints++
+	name := fmt.Sprintf("sp_%d", tx.savepoints)
+
+	err = tx.Savepoint(name)
+	if err != nil {
+		return
+	}
+
+	// Объекты после этой позиции присоединены внутри функции
+	joined := len(tx.parents)
+	rollback := func() {
+		if rerr := tx.RollbackTo(name); rerr != nil {
+			log.Println("[error]", rerr)
+		}
+		// Записи о присоединении остаются: их состояние теперь совпадает с текущим,
+		// а по завершении внешней транзакции объекты надо отсоединить
+		tx.restoreFrom(joined)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			rollback()
+			panic(r)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		// После deadlock MySQL уже откатил всю транзакцию - точки сохранения нет,
+		// объекты восстановит внешняя транзакция
+		// После lock wait timeout транзакция обычно жива и откатывать надо
+		if !isDeadlockError(err) {
+			rollback()
+		}
+		return
+	}
+
+	return tx.ReleaseSavepoint(name)
+}
+
+// Выполняем запрос для точки сохранения
+func (tx *Tx) savepointExec(cmd, name string) (err error) {
+	if !savepointNameReg.MatchString(name) {
+		err = errors.New("bad savepoint name: " + name)
+		log.Println("[error]", err)
+		return
+	}
+
+	_, err = tx.ExecContext(tx.ctx, cmd+" "+name)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	return
+}
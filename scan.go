@@ -0,0 +1,327 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+const (
+	defaultScanChunk   = 10000
+	defaultScanWorkers = 4
+)
+
+// Параметры параллельного обхода таблицы
+type ScanParam struct {
+	// Условие выборки, сортировка и лимиты не используются
+	Param *ForeachParam
+	Vals  []interface{}
+	// Размер диапазона первичного ключа на одну часть
+	ChunkSize int64
+	// Количество параллельных обработчиков
+	Workers int
+	// Файл для сохранения обработанных частей, при повторном запуске они пропускаются
+	// После успешного обхода файл удаляется
+	Checkpoint string
+}
+
+// Состояние обхода в файле
+type scanCheckpoint struct {
+	Table     string         `json:"table"`
+	ChunkSize int64          `json:"chunk_size"`
+	Filter    string         `json:"filter"`
+	Done      map[int64]bool `json:"done"`
+}
+
+// Параллельный обход таблицы частями по диапазонам первичного ключа
+// Первичный ключ должен быть целым. Объекты внутри части обрабатываются по порядку,
+// части - параллельно. При первой ошибке обход останавливается
+func (p *Parent) Scan(ctx context.Context, sp ScanParam, fn func(ctx context.Context, obj *Parent) error) (err error) {
+	if p.Tx != nil {
+		err = errors.New("scan can not be used in transaction")
+		log.Println("[error]", err)
+		return
+	}
+
+	if sp.ChunkSize <= 0 {
+		sp.ChunkSize = defaultScanChunk
+	}
+	if sp.Workers <= 0 {
+		sp.Workers = defaultScanWorkers
+	}
+
+	fp := ForeachParam{}
+	if sp.Param != nil {
+		fp = *sp.Param
+	}
+	if fp.lockMode() != LockNone || fp.TxOptions != nil {
+		err = errors.New("scan can not lock rows")
+		log.Println("[error]", err)
+		return
+	}
+	if len(fp.With) > 0 {
+		err = errWithUnsupported
+		log.Println("[error]", err)
+		return
+	}
+	fp.OrderBy = nil
+	fp.Limit = 0
+	fp.Offset = 0
+	fp.Cursor = ""
+	fp.GroupBy = ""
+
+	// Границы первичного ключа
+	minv, err := p.Min(&fp, p.PKey, sp.Vals...)
+	if err != nil {
+		return
+	}
+	maxv, err := p.Max(&fp, p.PKey, sp.Vals...)
+	if err != nil {
+		return
+	}
+
+	// Пустая выборка
+	if minv == nil || maxv == nil {
+		return removeCheckpoint(sp.Checkpoint)
+	}
+
+	from, ok1 := toInt64(minv)
+	to, ok2 := toInt64(maxv)
+	if !ok1 || !ok2 {
+		err = errors.New("scan requires integer primary key: " + p.DbTable)
+		log.Println("[error]", err)
+		return
+	}
+
+	// Начало частей кратно размеру, чтобы границы не зависели от текущего минимума
+	from = floorChunk(from, sp.ChunkSize)
+
+	filter, err := p.scanFilterHash(&fp, sp.Vals)
+	if err != nil {
+		return
+	}
+
+	cp, err := loadCheckpoint(sp.Checkpoint, p.DbTable, sp.ChunkSize, filter)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan int64)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	// Запоминаем первую ошибку и останавливаем остальных
+	fail := func(e error) {
+		mu.Lock()
+		if err == nil {
+			err = e
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	for w := 0; w < sp.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for start := range chunks {
+				e := p.scanChunk(ctx, fp, sp.Vals, start, start+sp.ChunkSize, fn)
+				if e != nil {
+					fail(e)
+					return
+				}
+
+				mu.Lock()
+				cp.Done[start] = true
+				e = saveCheckpoint(sp.Checkpoint, cp)
+				mu.Unlock()
+				if e != nil {
+					fail(e)
+					return
+				}
+			}
+		}()
+	}
+
+	// Раздаем части
+feed:
+	for start := from; start <= to; start += sp.ChunkSize {
+		if cp.Done[start] {
+			continue
+		}
+
+		select {
+		case chunks <- start:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	if err != nil {
+		return
+	}
+
+	// Внешний контекст мог быть отменен до обработки всех частей
+	if ctx.Err() != nil && cp.pending(from, to) {
+		err = ctx.Err()
+		return
+	}
+
+	return removeCheckpoint(sp.Checkpoint)
+}
+
+// Обработка одной части
+func (p *Parent) scanChunk(ctx context.Context, fp ForeachParam, vals []interface{}, from, to int64, fn func(ctx context.Context, obj *Parent) error) (err error) {
+	fp.Filter = And(fp.Filter, Gte(p.PKey, from), Lt(p.PKey, to))
+
+	// Отдельный объект, чтобы обработчики не делили состояние
+	for obj, e := range p.NewItem().Iter(ctx, &fp, vals...) {
+		if e != nil {
+			return e
+		}
+
+		err = fn(ctx, obj)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Округляем вниз до границы части
+func floorChunk(v, size int64) int64 {
+	r := v % size
+	if r < 0 {
+		r += size
+	}
+	return v - r
+}
+
+// Хеш условия выборки, чтобы не продолжить обход с другим фильтром
+func (p *Parent) scanFilterHash(fp *ForeachParam, vals []interface{}) (h string, err error) {
+	where, args, err := p.buildWhere(fp, vals)
+	if err != nil {
+		return
+	}
+
+	sum := sha256.Sum256([]byte(where + "\n" + fmt.Sprintf("%#v", args)))
+	h = hex.EncodeToString(sum[:])
+	return
+}
+
+// Остались ли необработанные части
+func (cp *scanCheckpoint) pending(from, to int64) bool {
+	for start := from; start <= to; start += cp.ChunkSize {
+		if !cp.Done[start] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Читаем состояние обхода
+func loadCheckpoint(path, table string, size int64, filter string) (cp *scanCheckpoint, err error) {
+	cp = &scanCheckpoint{Table: table, ChunkSize: size, Filter: filter, Done: make(map[int64]bool)}
+	if path == "" {
+		return
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+			return
+		}
+		log.Println("[error]", err)
+		return
+	}
+
+	saved := scanCheckpoint{}
+	err = json.Unmarshal(b, &saved)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	// Состояние от другого обхода использовать нельзя
+	if saved.Table != table || saved.ChunkSize != size || saved.Filter != filter {
+		err = errors.New("checkpoint does not match scan: " + path)
+		log.Println("[error]", err)
+		return
+	}
+
+	if saved.Done != nil {
+		cp.Done = saved.Done
+	}
+
+	return
+}
+
+// Сохраняем состояние обхода через временный файл
+func saveCheckpoint(path string, cp *scanCheckpoint) (err error) {
+	if path == "" {
+		return
+	}
+
+	b, err := json.Marshal(cp)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	return
+}
+
+// Удаляем состояние после завершения обхода
+func removeCheckpoint(path string) (err error) {
+	if path == "" {
+		return
+	}
+
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println("[error]", err)
+		return
+	}
+
+	return nil
+}
+
+// Приводим целое значение к int64
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+
+	return 0, false
+}
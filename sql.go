@@ -15,6 +15,10 @@ import (
 
 var (
 	Dbh *sqlx.DB
+	loc = time.Local
+
+	// Ошибка при откате без активной транзакции
+	ErrNoTx = errors.New("no active transaction")
 )
 
 // Подключение к базе
@@ -27,6 +31,11 @@ func Connect(o InitConnect) {
 		o.Charset = "utf8mb4"
 	}
 
+	// Часовой пояс для автоматических времен
+	if o.Location != nil {
+		loc = o.Location
+	}
+
 	// Если это конект по tcp
 	if mysqlTcpSocketReg.MatchString(o.Socket) {
 		socktype = "tcp"
@@ -40,6 +49,11 @@ func Connect(o InitConnect) {
 	}
 }
 
+// Текущее время в настроенном часовом поясе
+func Now() time.Time {
+	return time.Now().In(loc)
+}
+
 // MustBegin starts a transaction, and panics on error.  Returns an *sqlx.Tx instead
 // of an *sql.Tx.
 func MustBegin() *sqlx.Tx {
@@ -103,11 +117,14 @@ func (p *Parent) CreateFields() (err error) {
 		}
 
 		p.Fields = append(p.Fields, Field{
-			Name:   mt.Name,
-			Type:   mt.GetType(),
-			IsDb:   mt.IsDb(),
-			IsJson: mt.IsJson(),
-			Null:   mt.CanNull(),
+			Name:        mt.Name,
+			Type:        mt.GetType(),
+			IsDb:        mt.IsDb(),
+			IsJson:      mt.IsJson(),
+			Null:        mt.CanNull(),
+			AutoCreated: mt.IsAutoCreated() || mt.Name == p.CreatedField,
+			AutoUpdated: mt.IsAutoUpdated() || mt.Name == p.UpdatedField,
+			IsUUID:      mt.IsUUID(),
 		})
 
 		// Отмечаем что ключ уникальный
@@ -116,6 +133,8 @@ func (p *Parent) CreateFields() (err error) {
 		}
 	}
 
+	p.reindexFields()
+
 	// Проверяем что вторичные ключи уникальны
 	for _, k := range p.SKeys {
 		_, ok := skeys[k]
@@ -134,10 +153,14 @@ func (p *Parent) GetFromDB(o *InitObj) (err error) {
 	}
 
 	// Есть ли транзакция?
+	lock := o.lockMode()
 	if o.Tx != nil {
 		p.Tx = o.Tx
-	} else if o.ForUpdate {
-		p.Tx = MustBegin()
+	} else if lock != LockNone || o.TxOptions != nil {
+		p.Tx, err = beginTxx(o.TxOptions)
+		if err != nil {
+			return
+		}
 	}
 
 	// Если это пустая инициализация - то заканчиваем
@@ -166,7 +189,7 @@ func (p *Parent) GetFromDB(o *InitObj) (err error) {
 			}
 		}
 	} else { // Если нет ключей - возвращаем ошибку как будто ничего не нашли
-		err = errors.New("sql: no rows in result set")
+		err = sql.ErrNoRows
 		return
 	}
 
@@ -175,11 +198,14 @@ func (p *Parent) GetFromDB(o *InitObj) (err error) {
 		return
 	}
 
-	// Если надо залочить
-	if o.ForUpdate {
-		sqlrq += " FOR UPDATE"
+	// Исключаем мягко удаленные записи
+	if !o.WithDeleted && p.SoftDelete != "" {
+		sqlrq += " AND " + p.softDeleteCond()
 	}
 
+	// Если надо залочить
+	sqlrq += lockClause(lock, o.LockWait)
+
 	var rows *sql.Rows
 	if p.Tx != nil {
 		rows, err = p.Tx.Query(sqlrq, val)
@@ -197,96 +223,239 @@ func (p *Parent) GetFromDB(o *InitObj) (err error) {
 	return p.ParseDbFields(rows)
 }
 
-// Парсинг параметров полученных из базы
-func (p *Parent) ParseDbFields(rows *sql.Rows) (err error) {
-	// Отмечаем что это существующая запись
-	p.Existed = true
+// Перечитываем запись из базы по первичному ключу
+// Запрос выполняется в транзакции объекта, если она есть. Несохраненные изменения теряются
+func (p *Parent) Reload() (err error) {
+	return p.ReloadLock(LockNone, LockWaitDefault)
+}
+
+// Перечитываем запись с блокировкой строки
+// Если транзакции нет - она начинается, как в GetFromDB
+func (p *Parent) ReloadLock(lock LockMode, wait LockWait) (err error) {
+	pkv := p.Get(p.PKey)
+	if pkv == nil {
+		err = errors.New("can not reload without primary key: " + p.DbTable)
+		log.Println("[error]", err)
+		return
+	}
+
+	if lock != LockNone && p.Tx == nil {
+		p.Tx, err = beginTxx(nil)
+		if err != nil {
+			return
+		}
+	}
+
+	sqlrq := fmt.Sprintf(`SELECT %s FROM %s WHERE %s=?`, p.GetFiledsString(),
+		p.GetTableName(), p.PKey) + lockClause(lock, wait)
+
+	rows, err := p.query(sqlrq, []interface{}{pkv})
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
 
-	// Get column names
 	columns, err := rows.Columns()
 	if err != nil {
 		log.Println("[error]", err)
 		return
 	}
 
-	if !rows.Next() {
-		err = errors.New("sql: no rows in result set")
+	// Читаем в пустой объект, чтобы NULL из базы не оставил старое значение
+	fresh := p.NewItem()
+	err = fresh.parseDbRow(rows, fresh.columnPos(columns))
+	if err != nil {
+		log.Println("[error]", err)
 		return
 	}
 
-	// Make a slice for the values
-	values := make([]sql.RawBytes, len(columns))
-	scanArgs := make([]interface{}, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
+	p.Lock()
+	for i := range p.Fields {
+		if p.Fields[i].IsDb {
+			p.Fields[i].Value = fresh.Fields[i].Value
+			p.Fields[i].clearDirty()
+			p.Fields[i]._loaded = fresh.Fields[i]._loaded
+		}
 	}
+	p.Existed = true
+	p.Unlock()
+
+	return p.runHooks(AfterLoad)
+}
 
-	err = rows.Scan(scanArgs...)
+// Парсинг параметров полученных из базы
+func (p *Parent) ParseDbFields(rows *sql.Rows) (err error) {
+	// Get column names
+	columns, err := rows.Columns()
 	if err != nil {
 		log.Println("[error]", err)
 		return
 	}
 
-	for i, col := range values {
-		if col == nil {
-			continue
-		}
+	err = p.parseDbRow(rows, p.columnPos(columns))
+	if err != nil {
+		return
+	}
 
-		for k := range p.Fields {
-			if p.Fields[k].IsDb && p.Fields[k].Name == columns[i] {
-				switch p.Fields[k].Type {
-				case "int":
-					var v int64
-					v, err = strconv.ParseInt(string(col), 10, 32)
-					if err != nil {
-						log.Println("[error]", err, p.DbTable, p.Fields[k].Name, string(col))
-						return
-					}
-					p.Fields[k].Value = int(v)
-				case "int64":
-					var v int64
-					v, err = strconv.ParseInt(string(col), 10, 64)
-					if err != nil {
-						log.Println("[error]", err, p.DbTable, p.Fields[k].Name, string(col))
-						return
-					}
-					p.Fields[k].Value = v
-				case "float64":
-					var v float64
-					v, err = strconv.ParseFloat(string(col), 64)
-					if err != nil {
-						log.Println("[error]", err, p.DbTable, p.Fields[k].Name, string(col))
-						return
-					}
-					p.Fields[k].Value = v
-				case "string":
-					p.Fields[k].Value = string(col)
-				case "[]uint8":
-					p.Fields[k].Value = []byte(col)
-				case "time.Time":
-					var t time.Time
-					if string(col) != "0000-00-00 00:00:00" && string(col) != "0000-00-00" {
-						t, err = time.Parse("2006-01-02 15:04:05", string(col))
-						if err != nil {
-							t, err = time.Parse("2006-01-02", string(col))
-							if err != nil {
-								log.Println("[error]", err, p.DbTable, p.Fields[k].Name, string(col))
-								return
-							}
-						}
-					}
-					p.Fields[k].Value = t
+	return p.runHooks(AfterLoad)
+}
+
+// Преобразуем значение из базы в тип поля
+func parseValue(typ string, col []byte) (val interface{}, err error) {
+	switch typ {
+	case "int":
+		var v int64
+		v, err = strconv.ParseInt(string(col), 10, 32)
+		if err != nil {
+			return
+		}
+		val = int(v)
+	case "int64":
+		var v int64
+		v, err = strconv.ParseInt(string(col), 10, 64)
+		if err != nil {
+			return
+		}
+		val = v
+	case "float64":
+		var v float64
+		v, err = strconv.ParseFloat(string(col), 64)
+		if err != nil {
+			return
+		}
+		val = v
+	case "string":
+		val = string(col)
+	case "[]uint8":
+		// RawBytes переиспользуется драйвером - копируем
+		val = append([]byte(nil), col...)
+	case "time.Time":
+		var t time.Time
+		if string(col) != "0000-00-00 00:00:00" && string(col) != "0000-00-00" {
+			t, err = time.Parse("2006-01-02 15:04:05", string(col))
+			if err != nil {
+				t, err = time.Parse("2006-01-02", string(col))
+				if err != nil {
+					return
 				}
+			}
+		}
+		val = t
+	}
 
+	return
+}
+
+// Заполняем время создания и обновления
+func (p *Parent) fillTimestamps() {
+	p.Lock()
+	defer p.Unlock()
+
+	// Для существующей записи время обновляем только если есть изменения
+	if p.Existed {
+		changed := false
+		for _, f := range p.Fields {
+			if f._to_commit && f.IsDb && !p.isUpdatedField(&f) {
+				changed = true
 				break
 			}
 		}
+		if !changed {
+			return
+		}
 	}
 
-	return
+	t := Now()
+	for i := range p.Fields {
+		f := &p.Fields[i]
+		if !f.IsDb {
+			continue
+		}
+
+		// Время создания ставим только если его не указали вручную
+		if !p.Existed && p.isCreatedField(f) && !f._to_commit {
+			if !f.setNow(t) {
+				log.Println("[error]", "bad type for created field", p.DbTable, f.Name, f.Type)
+			}
+		}
+
+		// Время обновления ставим только если его не указали вручную
+		if p.isUpdatedField(f) && !f._to_commit {
+			if !f.setNow(t) {
+				log.Println("[error]", "bad type for updated field", p.DbTable, f.Name, f.Type)
+			}
+		}
+	}
+}
+
+// Поле времени создания, по флагу из описания или по имени
+// Описание могло быть получено до установки CreatedField
+func (p *Parent) isCreatedField(f *Field) bool {
+	return f.AutoCreated || (p.CreatedField != "" && f.Name == p.CreatedField)
+}
+
+// Поле времени обновления, по флагу из описания или по имени
+func (p *Parent) isUpdatedField(f *Field) bool {
+	return f.AutoUpdated || (p.UpdatedField != "" && f.Name == p.UpdatedField)
 }
 
 func (p *Parent) CommitTx(txcommit bool) (err error) {
+	// Общую транзакцию коммитит WithTx
+	if p.txManaged {
+		txcommit = false
+	}
+
+	// Транзакцию завершит вызывающий, при откате Rollback вернет это состояние
+	if p.Tx != nil && !txcommit && !p.txManaged {
+		p.snapshotTx()
+	}
+
+	// Первичный ключ для новой записи
+	err = p.fillPK()
+	if err != nil {
+		return
+	}
+
+	// Автоматически заполняемые времена
+	p.fillTimestamps()
+
+	// Обработчики вызываются только если будет запись, в том числе для новой записи
+	// только с ключом и временами
+	if p.HasChanges() {
+		ev := BeforeUpdate
+		if !p.Existed {
+			ev = BeforeInsert
+		}
+		err = p.runHooks(BeforeSave, ev)
+		if err != nil {
+			return
+		}
+
+		// Обработчики могли изменить поля, тогда нужно и время обновления
+		p.fillTimestamps()
+	}
+
+	// Журнал изменений пишется в той же транзакции
+	var audit *AuditEntry
+	if p.Audit != nil && p.HasChanges() {
+		action := AuditUpdate
+		if !p.Existed {
+			action = AuditInsert
+		}
+		audit = p.newAudit(action, p.Changes())
+	}
+	owned, err := p.auditBegin(audit)
+	if err != nil {
+		return
+	}
+	if owned {
+		txcommit = true
+		defer func() { p.auditRollback(owned, err) }()
+	}
+
 	sqlstr := []string{}
 	params := []interface{}{}
 	var pkv interface{}
@@ -324,9 +493,12 @@ func (p *Parent) CommitTx(txcommit bool) (err error) {
 		}
 	}
 
-	if len(sqlstr) > 0 {
+	inserted := !p.Existed
+	written := len(sqlstr) > 0
+
+	if written {
 		// Если создаем новую запись
-		if !p.Existed {
+		if inserted {
 			var r1 sql.Result
 			sqlrq := fmt.Sprintf(`INSERT INTO %s SET %s`, p.GetTableName(),
 				strings.Join(sqlstr, ","))
@@ -341,9 +513,6 @@ func (p *Parent) CommitTx(txcommit bool) (err error) {
 				return
 			}
 
-			// Отмечаем что это существующая запись
-			p.Existed = true
-
 			var id int64
 			id, err = r1.LastInsertId()
 			if err != nil {
@@ -351,16 +520,16 @@ func (p *Parent) CommitTx(txcommit bool) (err error) {
 				return
 			}
 
-			if id > 0 {
-				for i := range p.Fields {
-					// Запоминаем главный ключ
-					if p.Fields[i].Name == p.PKey {
-						if p.Fields[i].Type == "int" {
-							p.Fields[i].Value = int(id)
-						} else {
-							p.Fields[i].Value = id
-						}
-					}
+			// Запоминаем главный ключ, если он автоинкрементный
+			// Нецелые ключи (UUID, ULID) задаются до вставки и уже есть в объекте
+			if i := p.fieldPos(p.PKey); id > 0 && i >= 0 {
+				switch p.Fields[i].Type {
+				case "int":
+					p.Fields[i].Value = int(id)
+					p.Fields[i]._loaded = true
+				case "int64":
+					p.Fields[i].Value = id
+					p.Fields[i]._loaded = true
 				}
 			}
 		} else {
@@ -380,17 +549,54 @@ func (p *Parent) CommitTx(txcommit bool) (err error) {
 				return
 			}
 		}
+
+		// Ключ новой записи известен только после вставки
+		if audit != nil {
+			audit.PK = p.Get(p.PKey)
+			err = p.writeAudit(audit)
+			if err != nil {
+				return
+			}
+		}
 	}
 
 	// Если надо сделать коммит
 	if p.Tx != nil && txcommit {
-		err = p.Tx.Commit()
+		err = p.commitTx()
 		if err != nil {
-			log.Println("[error]", err)
 			return
 		}
 	}
 
+	if !written {
+		return
+	}
+
+	// Только после успешной записи отмечаем что запись существует и изменения сохранены
+	// Внутри транзакции при ее откате состояние восстанавливает WithTx или Rollback
+	p.Lock()
+	p.Existed = true
+	p.Unlock()
+	p.clearDirty()
+
+	// Перечитываем запись, чтобы получить значения посчитанные базой
+	if p.RefreshOnCommit || (inserted && p.RefreshOnInsert) {
+		err = p.Reload()
+		if err != nil {
+			return
+		}
+	}
+
+	// Обработчики после сохранения уже не могут его отменить
+	ev := AfterUpdate
+	if inserted {
+		ev = AfterInsert
+	}
+	err = p.runHooks(ev, AfterSave)
+	if err != nil {
+		return
+	}
+
 	return
 }
 
@@ -400,8 +606,18 @@ func (p *Parent) Commit() (err error) {
 }
 
 // Откат
+// Объект возвращается в состояние до первого CommitTx(false) в этой транзакции
 func (p *Parent) Rollback() (err error) {
-	err = p.Tx.Rollback()
+	if p.Tx == nil {
+		return ErrNoTx
+	}
+
+	// После отката транзакция завершена в любом случае
+	tx := p.Tx
+	p.Tx = nil
+	p.finishTx(tx, true)
+
+	err = tx.Rollback()
 	if err != nil {
 		log.Println("[error]", err)
 		return
@@ -410,29 +626,23 @@ func (p *Parent) Rollback() (err error) {
 	return
 }
 
-// Удаление записи
-func (p *Parent) Delete() (err error) {
-	pkv := p.Get(p.PKey)
-	sqlrq := fmt.Sprintf(`DELETE FROM %s WHERE %s=?`, p.GetTableName(), p.PKey)
+// Есть ли у объекта активная транзакция
+func (p *Parent) InTx() bool {
+	return p.Tx != nil
+}
 
-	if p.Tx != nil {
-		_, err = p.Tx.Exec(sqlrq, pkv)
-	} else {
-		_, err = Dbh.Exec(sqlrq, pkv)
-	}
+// Коммит транзакции объекта
+func (p *Parent) commitTx() (err error) {
+	// После коммита транзакция завершена в любом случае
+	tx := p.Tx
+	p.Tx = nil
+
+	err = tx.Commit()
+	p.finishTx(tx, err != nil)
 	if err != nil {
 		log.Println("[error]", err)
 		return
 	}
 
-	// Если надо сделать коммит
-	if p.Tx != nil {
-		err = p.Tx.Commit()
-		if err != nil {
-			log.Println("[error]", err)
-			return
-		}
-	}
-
 	return
 }
@@ -0,0 +1,330 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrDeadlock        = 1213
+
+	defaultTxRetries = 3
+	defaultTxBackoff = 50 * time.Millisecond
+)
+
+// Параметры транзакции
+type TxOptions struct {
+	// Сколько раз повторять при deadlock и lock wait timeout (0 - по умолчанию, <0 - не повторять)
+	MaxRetries int
+	// Базовая задержка перед повтором, удваивается с каждой попыткой
+	Backoff time.Duration
+	// Уровень изоляции (по умолчанию - уровень сервера)
+	Isolation sql.IsolationLevel
+	// Транзакция только для чтения
+	ReadOnly bool
+}
+
+// Параметры для database/sql
+func (o *TxOptions) sqlOptions() *sql.TxOptions {
+	if o == nil {
+		return nil
+	}
+
+	return &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}
+}
+
+// Режим блокировки строк при выборке
+type LockMode int
+
+const (
+	LockNone LockMode = iota
+	LockForUpdate
+	LockForShare
+	LockInShareMode
+)
+
+// Поведение при уже заблокированных строках
+type LockWait int
+
+const (
+	LockWaitDefault LockWait = iota
+	LockNoWait
+	LockSkipLocked
+)
+
+// Формируем окончание запроса для блокировки строк
+func lockClause(mode LockMode, wait LockWait) (s string) {
+	switch mode {
+	case LockForUpdate:
+		s = " FOR UPDATE"
+	case LockForShare:
+		s = " FOR SHARE"
+	case LockInShareMode:
+		// Старый синтаксис не поддерживает NOWAIT и SKIP LOCKED
+		return " LOCK IN SHARE MODE"
+	default:
+		return
+	}
+
+	switch wait {
+	case LockNoWait:
+		s += " NOWAIT"
+	case LockSkipLocked:
+		s += " SKIP LOCKED"
+	}
+
+	return
+}
+
+// Начинаем транзакцию для объекта
+func beginTxx(opts *TxOptions) (tx *sqlx.Tx, err error) {
+	tx, err = Dbh.BeginTxx(context.Background(), opts.sqlOptions())
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	return
+}
+
+// Транзакция к которой можно присоединять объекты
+type Tx struct {
+	*sqlx.Tx
+	ctx        context.Context
+	parents    []*Parent
+	states     []parentState
+	savepoints int
+}
+
+// Состояние объекта до записи в транзакцию, которую объект завершает сам
+type txSnapshot struct {
+	tx    *sqlx.Tx
+	state parentState
+}
+
+// Состояние объекта на момент присоединения к транзакции
+type parentState struct {
+	existed bool
+	fields  []Field
+	// Контекст объекту назначила транзакция
+	ctxSet bool
+}
+
+// Ключ транзакции в контексте
+type txCtxKey struct{}
+
+// Начинаем транзакцию
+func BeginTx(ctx context.Context, opts *TxOptions) (tx *Tx, err error) {
+	t, err := Dbh.BeginTxx(ctx, opts.sqlOptions())
+	if err != nil {
+		log.Println("[error]", err)
+		return
+	}
+
+	tx = &Tx{Tx: t}
+	tx.ctx = context.WithValue(ctx, txCtxKey{}, tx)
+	return
+}
+
+// Контекст с этой транзакцией, WithTx с ним выполнится во вложенной транзакции
+func (tx *Tx) Context() context.Context {
+	return tx.ctx
+}
+
+// Получаем транзакцию из контекста
+func TxFromContext(ctx context.Context) *Tx {
+	tx, _ := ctx.Value(txCtxKey{}).(*Tx)
+	return tx
+}
+
+// Присоединяем объекты к транзакции
+// Коммит выполняет WithTx, поэтому Commit, Delete и другие методы присоединенных объектов
+// только пишут в транзакцию и не завершают ее
+func (tx *Tx) Join(objs ...*Parent) {
+	for _, p := range objs {
+		p.RLock()
+		st := p.saveState()
+		p.RUnlock()
+
+		p.Tx = tx.Tx
+		p.txManaged = true
+		if p.ctx == nil {
+			p.ctx = tx.ctx
+			st.ctxSet = true
+		}
+		tx.states = append(tx.states, st)
+		tx.parents = append(tx.parents, p)
+	}
+}
+
+// Отсоединяем объекты после завершения транзакции
+func (tx *Tx) release() {
+	for i, p := range tx.parents {
+		if p.Tx == tx.Tx {
+			p.Tx = nil
+			p.txManaged = false
+		}
+		// Контекст транзакции после ее завершения уже недействителен
+		if tx.states[i].ctxSet && p.ctx == tx.ctx {
+			p.ctx = nil
+		}
+	}
+	tx.parents = nil
+	tx.states = nil
+}
+
+// Возвращаем объекты в состояние до транзакции после ее отката
+// Иначе при повторе они считали бы откатанные изменения сохраненными
+func (tx *Tx) restore() {
+	tx.restoreFrom(0)
+}
+
+// Возвращаем состояние объектов, присоединенных начиная с позиции n
+func (tx *Tx) restoreFrom(n int) {
+	// С конца, чтобы дважды присоединенный объект получил самое раннее состояние
+	for i := len(tx.parents) - 1; i >= n; i-- {
+		p, st := tx.parents[i], tx.states[i]
+
+		p.Lock()
+		p.restoreState(st)
+		p.Unlock()
+	}
+}
+
+// Копия состояния объекта, вызывается под блокировкой
+func (p *Parent) saveState() parentState {
+	st := parentState{existed: p.Existed, fields: make([]Field, len(p.Fields))}
+	copy(st.fields, p.Fields)
+	return st
+}
+
+// Возвращаем сохраненное состояние, вызывается под блокировкой
+func (p *Parent) restoreState(st parentState) {
+	p.Existed = st.existed
+	p.Fields = make([]Field, len(st.fields))
+	copy(p.Fields, st.fields)
+}
+
+// Запоминаем состояние перед записью в транзакцию объекта
+// Повторные записи в ту же транзакцию снимок не меняют
+func (p *Parent) snapshotTx() {
+	p.Lock()
+	if p.txSnap == nil || p.txSnap.tx != p.Tx {
+		p.txSnap = &txSnapshot{tx: p.Tx, state: p.saveState()}
+	}
+	p.Unlock()
+}
+
+// Завершение транзакции объекта: при откате возвращаем состояние до нее
+func (p *Parent) finishTx(tx *sqlx.Tx, rollback bool) {
+	p.Lock()
+	if s := p.txSnap; s != nil && s.tx == tx {
+		if rollback {
+			p.restoreState(s.state)
+		}
+		p.txSnap = nil
+	}
+	p.Unlock()
+}
+
+// Выполняем функцию в транзакции
+// При ошибке или панике транзакция откатывается, при deadlock функция выполняется заново
+// Если в контексте уже есть транзакция - функция выполняется во вложенной через SAVEPOINT
+func WithTx(ctx context.Context, opts *TxOptions, fn func(tx *Tx) error) (err error) {
+	if tx := TxFromContext(ctx); tx != nil {
+		return tx.Nested(fn)
+	}
+
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+
+	retries := opts.MaxRetries
+	if retries == 0 {
+		retries = defaultTxRetries
+	}
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = defaultTxBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = runTx(ctx, opts, fn)
+		if err == nil || !IsRetryableTxError(err) || attempt >= retries {
+			return
+		}
+
+		log.Println("[info]", "retry transaction", attempt+1, err)
+
+		// Ждем перед повтором
+		d := backoff<<attempt + time.Duration(rand.Int63n(int64(backoff)))
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Одна попытка выполнения транзакции
+func runTx(ctx context.Context, opts *TxOptions, fn func(tx *Tx) error) (err error) {
+	tx, err := BeginTx(ctx, opts)
+	if err != nil {
+		return
+	}
+	defer tx.release()
+
+	defer func() {
+		if r := recover(); r != nil {
+			if rerr := tx.Rollback(); rerr != nil {
+				log.Println("[error]", rerr)
+			}
+			tx.restore()
+			panic(r)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			log.Println("[error]", rerr)
+		}
+		tx.restore()
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Println("[error]", err)
+		tx.restore()
+		return
+	}
+
+	return
+}
+
+// Проверяем что транзакция откатилась из-за deadlock
+func isDeadlockError(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == mysqlErrDeadlock
+}
+
+// Проверяем можно ли повторить транзакцию после ошибки
+func IsRetryableTxError(err error) bool {
+	var me *mysql.MySQLError
+	if !errors.As(err, &me) {
+		return false
+	}
+
+	return me.Number == mysqlErrDeadlock || me.Number == mysqlErrLockWaitTimeout
+}
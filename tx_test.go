@@ -0,0 +1,26 @@
+package db
+
+import "testing"
+
+func TestLockClause(t *testing.T) {
+	for _, tc := range []struct {
+		mode LockMode
+		wait LockWait
+		want string
+	}{
+		{LockNone, LockWaitDefault, ""},
+		{LockNone, LockNoWait, ""},
+		{LockForUpdate, LockWaitDefault, " FOR UPDATE"},
+		{LockForUpdate, LockNoWait, " FOR UPDATE NOWAIT"},
+		{LockForUpdate, LockSkipLocked, " FOR UPDATE SKIP LOCKED"},
+		{LockForShare, LockWaitDefault, " FOR SHARE"},
+		{LockForShare, LockNoWait, " FOR SHARE NOWAIT"},
+		{LockForShare, LockSkipLocked, " FOR SHARE SKIP LOCKED"},
+		{LockInShareMode, LockWaitDefault, " LOCK IN SHARE MODE"},
+		{LockInShareMode, LockSkipLocked, " LOCK IN SHARE MODE"},
+	} {
+		if s := lockClause(tc.mode, tc.wait); s != tc.want {
+			t.Errorf("lockClause(%d, %d) = %q, want %q", tc.mode, tc.wait, s, tc.want)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"reflect"
 	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -20,13 +22,17 @@ var (
 	mysqlTimeStampReg *regexp.Regexp
 	mysqlNoJsReg      *regexp.Regexp
 	mysqlNoDbReg      *regexp.Regexp
+	mysqlCreatedReg   *regexp.Regexp
+	mysqlUpdatedReg   *regexp.Regexp
+	mysqlUUIDReg      *regexp.Regexp
 	mysqlTcpSocketReg *regexp.Regexp
 
-	fpOrderByCleanReg *regexp.Regexp
-	fpLimitCleanReg   *regexp.Regexp
 	fpGroupByCleanReg *regexp.Regexp
 	fpFieldsCleanReg  *regexp.Regexp
 	fpWhereCleanReg   *regexp.Regexp
+
+	savepointNameReg *regexp.Regexp
+	columnNameReg    *regexp.Regexp
 )
 
 func init() {
@@ -40,12 +46,16 @@ func init() {
 
 	mysqlNoJsReg = regexp.MustCompile("nojson")
 	mysqlNoDbReg = regexp.MustCompile("--deleted--")
+	mysqlCreatedReg = regexp.MustCompile("autocreated")
+	mysqlUpdatedReg = regexp.MustCompile("autoupdated")
+	mysqlUUIDReg = regexp.MustCompile("uuid")
 
-	fpOrderByCleanReg = regexp.MustCompile("[^a-zA-Z0-9,()_.='` \n\r\t]")
-	fpLimitCleanReg = regexp.MustCompile("[^0-9,]")
 	fpGroupByCleanReg = regexp.MustCompile("[^a-zA-Z0-9,()_` \n\r\t]")
 	fpFieldsCleanReg = regexp.MustCompile("[^a-zA-Z0-9_,`*]")
 	fpWhereCleanReg = regexp.MustCompile("[^a-zA-Z0-9,()_.='` ?<>\n\r\t*+-]")
+
+	savepointNameReg = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+	columnNameReg = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*(\\.[a-zA-Z_][a-zA-Z0-9_]*)?$")
 }
 
 // Объект конекта к базе
@@ -55,6 +65,8 @@ type InitConnect struct {
 	Socket   string
 	DBName   string
 	Charset  string
+	// Часовой пояс для автоматически заполняемых времен (по умолчанию локальный)
+	Location *time.Location
 }
 
 // Родительский объект
@@ -64,8 +76,36 @@ type Parent struct {
 	PKey       string
 	SKeys      []string
 	MapAddFunc func(map[string]interface{})
-	Tx         *sqlx.Tx
-	Existed    bool
+	// Удаление и переименование ключей GetMap под версию API
+	MapVersionFunc func(m map[string]interface{}, version string)
+	Tx             *sqlx.Tx
+	Existed        bool
+	// Поле с временем удаления, если для таблицы включено мягкое удаление
+	SoftDelete string
+	// Поля с временем создания и обновления, заполняются при коммите
+	CreatedField string
+	UpdatedField string
+	// Связи с другими таблицами и загруженные связанные объекты
+	Relations []Relation
+	related   map[string]interface{}
+	fieldIdx  atomic.Pointer[fieldIndex]
+	// Подгружать из базы поля, не выбранные при инициализации, при первом обращении
+	LazyLoad bool
+	// Перечитывать запись после сохранения
+	RefreshOnCommit bool
+	// Перечитывать запись после вставки, чтобы получить DEFAULT и вычисляемые значения
+	RefreshOnInsert bool
+	// Как получать первичный ключ для новой записи
+	PKStrategy PKStrategy
+	PKFunc     func() (interface{}, error)
+	// Журнал изменений, nil - не писать
+	Audit AuditSink
+	ctx   context.Context
+	hooks map[HookEvent][]HookFunc
+	// Транзакцией управляет WithTx, сам объект ее не коммитит
+	txManaged bool
+	// Состояние до первой записи в транзакцию, которую объект завершает сам
+	txSnap *txSnapshot
 	sync.RWMutex
 }
 
@@ -77,8 +117,13 @@ type Field struct {
 	IsJson         bool
 	IsDb           bool
 	Null           bool
+	AutoCreated    bool
+	AutoUpdated    bool
+	IsUUID         bool
 	_special_value string
 	_to_commit     bool
+	_original      interface{}
+	_loaded        bool
 }
 
 // Преобразование значения времени в строку понятную mysql
@@ -91,6 +136,28 @@ func (f *Field) FormatTime() string {
 	return t.Format(GetMysqlTimeFormat())
 }
 
+// Устанавливаем текущее время в формате типа поля
+func (f *Field) setNow(t time.Time) bool {
+	old := f.Value
+	switch f.Type {
+	case "time.Time":
+		f.Value = t
+	case "int64":
+		f.Value = t.Unix()
+	case "int":
+		f.Value = int(t.Unix())
+	default:
+		return false
+	}
+
+	if !f._to_commit {
+		f._original = old
+	}
+	f._to_commit = true
+	f._special_value = ""
+	return true
+}
+
 // Проверяем не надо ли значение заменить на NULL
 func (f *Field) CheckNullValue(v interface{}) {
 	// Если NULL не подходит
@@ -142,36 +209,52 @@ type ForeachItemInterfaceObj struct {
 
 // Объект для запроса группы объектов
 type ForeachParam struct {
-	OrderBy     string
-	Limit       string
+	OrderBy []Order
+	Limit   int
+	Offset  int
+	// Токен следующей страницы, полученный из NextCursor
+	Cursor      string
 	GroupBy     string
 	Where       string
 	Fields      string
 	CondEntries []string
+	Filter      Cond
 	ForUpdate   bool
+	WithDeleted bool
+	// Вместо исправления параметров возвращать ошибку и проверять названия колонок
+	Strict    bool
+	Lock      LockMode
+	LockWait  LockWait
+	TxOptions *TxOptions
+	// Связи, которые надо загрузить вместе с объектами
+	// Только для ForeachItemOf и ForeachItemMapOf, остальные выборки возвращают ошибку
+	With []string
 }
 
-func (fp *ForeachParam) Clean() {
+// Режим блокировки с учетом ForUpdate
+func (fp *ForeachParam) lockMode() LockMode {
+	if fp.Lock == LockNone && fp.ForUpdate {
+		return LockForUpdate
+	}
+
+	return fp.Lock
+}
+
+// Подчищаем параметры запроса
+// В строгом режиме параметры не изменяются, а недопустимые символы возвращаются ошибкой
+func (fp *ForeachParam) Clean() (err error) {
 	if fp == nil {
 		return
 	}
 
-	ob := fpOrderByCleanReg.ReplaceAllString(fp.OrderBy, "")
-	lm := fpLimitCleanReg.ReplaceAllString(fp.Limit, "")
+	if fp.Strict {
+		return fp.check()
+	}
+
 	gb := fpGroupByCleanReg.ReplaceAllString(fp.GroupBy, "")
 	fi := fpFieldsCleanReg.ReplaceAllString(fp.Fields, "")
 	wh := fpWhereCleanReg.ReplaceAllString(fp.Where, "")
 
-	if ob != fp.OrderBy {
-		log.Println("[info]", "order by", ob, fp.OrderBy)
-	}
-	fp.OrderBy = ob
-
-	if lm != fp.Limit {
-		log.Println("[info]", "limit", lm, fp.Limit)
-	}
-	fp.Limit = lm
-
 	if gb != fp.GroupBy {
 		log.Println("[info]", "group by", gb, fp.GroupBy)
 	}
@@ -195,17 +278,32 @@ func (fp *ForeachParam) Clean() {
 
 		fp.CondEntries[i] = wh2
 	}
+
+	return
 }
 
 // Объект для инициализации значения из базы
 type InitObj struct {
-	PK        string
-	SKN       string
-	SKV       string
-	Fields    string
-	ForUpdate bool
-	Tx        *sqlx.Tx
-	Empty     bool
+	PK          string
+	SKN         string
+	SKV         string
+	Fields      string
+	ForUpdate   bool
+	Tx          *sqlx.Tx
+	Empty       bool
+	WithDeleted bool
+	Lock        LockMode
+	LockWait    LockWait
+	TxOptions   *TxOptions
+}
+
+// Режим блокировки с учетом ForUpdate
+func (o *InitObj) lockMode() LockMode {
+	if o.Lock == LockNone && o.ForUpdate {
+		return LockForUpdate
+	}
+
+	return o.Lock
 }
 
 // Объект типа строки в mysql
@@ -251,6 +349,18 @@ func (mt mysqlType) IsDb() (ok bool) {
 	return
 }
 
+func (mt mysqlType) IsAutoCreated() bool {
+	return mysqlCreatedReg.MatchString(mt.Comment)
+}
+
+func (mt mysqlType) IsAutoUpdated() bool {
+	return mysqlUpdatedReg.MatchString(mt.Comment)
+}
+
+func (mt mysqlType) IsUUID() bool {
+	return mysqlUUIDReg.MatchString(mt.Comment)
+}
+
 func (mt mysqlType) CanNull() (ok bool) {
 	if mt.Null == "NO" {
 		return
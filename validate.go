@@ -0,0 +1,96 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Ошибка проверки параметров запроса
+type ValidationError struct {
+	Param    string
+	Value    string
+	Rejected string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: rejected %q", e.Param, e.Value, e.Rejected)
+}
+
+// Проверяем параметры без изменения
+func (fp *ForeachParam) check() error {
+	errs := []error{}
+
+	add := func(name, v string, reg *regexp.Regexp) {
+		bad := reg.FindAllString(v, -1)
+		if len(bad) > 0 {
+			errs = append(errs, &ValidationError{Param: name, Value: v, Rejected: strings.Join(bad, "")})
+		}
+	}
+
+	add("GroupBy", fp.GroupBy, fpGroupByCleanReg)
+	add("Fields", fp.Fields, fpFieldsCleanReg)
+	add("Where", fp.Where, fpWhereCleanReg)
+	for i, v := range fp.CondEntries {
+		add(fmt.Sprintf("CondEntries[%d]", i), v, fpWhereCleanReg)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Проверяем что в параметрах указаны только известные колонки таблицы
+func (p *Parent) ValidateParam(fp *ForeachParam) (err error) {
+	if fp == nil {
+		return
+	}
+
+	err = fp.check()
+	if err != nil {
+		return
+	}
+
+	known := make(map[string]bool, len(p.Fields))
+	for _, f := range p.Fields {
+		if f.IsDb {
+			known[f.Name] = true
+		}
+	}
+
+	errs := []error{}
+	add := func(name, list string) {
+		if list == "" {
+			return
+		}
+
+		for _, c := range strings.Split(list, ",") {
+			c = strings.Trim(strings.TrimSpace(c), "`")
+
+			if c == "*" && name == "Fields" {
+				continue
+			}
+			if !known[c] {
+				errs = append(errs, &ValidationError{Param: name, Value: list, Rejected: c})
+			}
+		}
+	}
+
+	add("Fields", fp.Fields)
+	add("GroupBy", fp.GroupBy)
+	for _, o := range fp.OrderBy {
+		if !known[o.Col] {
+			errs = append(errs, &ValidationError{Param: "OrderBy", Value: o.Col, Rejected: o.Col})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Подчищаем параметры, в строгом режиме еще и проверяем колонки
+func (p *Parent) cleanParam(fp *ForeachParam) error {
+	if fp != nil && fp.Strict {
+		return p.ValidateParam(fp)
+	}
+
+	return fp.Clean()
+}